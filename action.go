@@ -2,8 +2,6 @@ package xweb
 
 import (
 	"bytes"
-	"compress/flate"
-	"compress/gzip"
 	"crypto/hmac"
 	"crypto/md5"
 	"crypto/sha1"
@@ -15,6 +13,7 @@ import (
 	"fmt"
 	"html/template"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"mime"
 	"mime/multipart"
@@ -53,6 +52,13 @@ type Action struct {
 	RootTemplate *template.Template
 	RequestBody  []byte
 	StatusCode   int
+	webSocket    *WebSocketConn
+	eventStream  *EventStream
+	cache        *cachePolicy
+	cacheWriter  *cacheWriter
+	layout       *string
+	lang         string
+	location     *time.Location
 }
 
 type Mapper struct {
@@ -215,17 +221,32 @@ func (c *Action) Cookie(key string) string {
 }
 
 // Body returns the raw request body data as bytes.
+// Read errors are logged, use ReadBody to handle them.
 func (c *Action) Body() []byte {
+	requestbody, err := c.ReadBody()
+	if err != nil {
+		c.Errorf("read request body: %v", err)
+	}
+	return requestbody
+}
+
+// ReadBody returns the raw request body data as bytes. It fails when
+// the body exceeds the App's or the route's MaxBodySize; returning
+// that error from the handler sends a 413 response.
+func (c *Action) ReadBody() ([]byte, error) {
 	if len(c.RequestBody) > 0 {
-		return c.RequestBody
+		return c.RequestBody, nil
 	}
 
-	requestbody, _ := ioutil.ReadAll(c.Request.Body)
+	requestbody, err := ioutil.ReadAll(c.Request.Body)
 	c.Request.Body.Close()
+	if err != nil {
+		return nil, err
+	}
 	bf := bytes.NewBuffer(requestbody)
 	c.Request.Body = ioutil.NopCloser(bf)
 	c.RequestBody = requestbody
-	return requestbody
+	return requestbody, nil
 }
 
 func (c *Action) DisableHttpCache() {
@@ -236,61 +257,60 @@ func (c *Action) DisableHttpCache() {
 	c.SetHeader("Pragma", "no-cache")
 }
 
+// HttpCache sets a strong ETag computed from content and answers the
+// conditional GET and HEAD requests, a Last-Modified header set by the
+// handler is used too. It returns true when a 304 response was sent.
 func (c *Action) HttpCache(content []byte) bool {
+	if c.Method() != "GET" && c.Method() != "HEAD" {
+		return false
+	}
 	h := md5.New()
 	h.Write(content)
-	Etag := hex.EncodeToString(h.Sum(nil))
-	//c.SetHeader("Connection", "keep-alive")
-	c.SetHeader("X-Cache", "HIT from COSCMS-Page-Cache")
-	//c.SetHeader("X-Cache", "HIT from COSCMS-Page-Cache 2013-12-02 17:16:01")
-	if inm := c.Header("If-None-Match"); inm != "" && inm == Etag {
-		h := c.ResponseWriter.Header()
-		delete(h, "Content-Type")
-		delete(h, "Content-Length")
-		c.ResponseWriter.WriteHeader(http.StatusNotModified)
+	etag := `"` + hex.EncodeToString(h.Sum(nil)) + `"`
+	var modtime time.Time
+	if lm := c.ResponseWriter.Header().Get("Last-Modified"); lm != "" {
+		modtime, _ = http.ParseTime(lm)
+	}
+	if c.CheckPreconditions(etag, modtime) {
 		return true
 	}
-	c.SetHeader("Etag", Etag)
-	c.SetHeader("Cache-Control", "public,max-age=1")
+	if c.ResponseWriter.Header().Get("Cache-Control") == "" {
+		c.SetHeader("Cache-Control", "public,max-age=1")
+	}
 	return false
 }
 
-// Body sets response body content.
-// if EnableGzip, compress content string.
+// Body sets response body content, which varies with Accept-Encoding.
+// if EnableGzip, compress content string with the encoding preferred
+// by the client when it's large enough and of a compressible type.
 // it sends out response body directly.
 func (c *Action) SetBody(content []byte) error {
 	if c.App.AppConfig.EnableHttpCache && c.HttpCache(content) {
 		return nil
 	}
-	output_writer := c.ResponseWriter.(io.Writer)
-	if c.App.Server.Config.EnableGzip == true && c.Header("Accept-Encoding") != "" {
-		splitted := strings.SplitN(c.Header("Accept-Encoding"), ",", -1)
-		encodings := make([]string, len(splitted))
-
-		for i, val := range splitted {
-			encodings[i] = strings.TrimSpace(val)
+	if c.Header("Range") != "" && c.acceptsRange() {
+		c.serveRange(content)
+		return nil
+	}
+	addVary(c.ResponseWriter.Header(), "Accept-Encoding")
+	if encoding := c.compressEncoding(content); encoding != "" {
+		zw, err := newCompressWriter(c.ResponseWriter, encoding, false)
+		if err != nil {
+			return err
 		}
-		for _, val := range encodings {
-			if val == "gzip" {
-				c.SetHeader("Content-Encoding", "gzip")
-				output_writer, _ = gzip.NewWriterLevel(c.ResponseWriter, gzip.BestSpeed)
-				break
-			} else if val == "deflate" {
-				c.SetHeader("Content-Encoding", "deflate")
-				output_writer, _ = flate.NewWriter(c.ResponseWriter, flate.BestSpeed)
-				break
-			}
+		c.SetHeader("Content-Encoding", encoding)
+		c.ResponseWriter.Header().Del("Content-Length")
+		if _, err = zw.Write(content); err != nil {
+			zw.Close()
+			return err
 		}
-	} else {
-		c.SetHeader("Content-Length", strconv.Itoa(len(content)))
+		return zw.Close()
 	}
-	_, err := output_writer.Write(content)
-	switch output_writer.(type) {
-	case *gzip.Writer:
-		output_writer.(*gzip.Writer).Close()
-	case *flate.Writer:
-		output_writer.(*flate.Writer).Close()
+	if c.acceptsRange() {
+		c.SetHeader("Accept-Ranges", "bytes")
 	}
+	c.SetHeader("Content-Length", strconv.Itoa(len(content)))
+	_, err := c.ResponseWriter.Write(content)
 	return err
 }
 
@@ -344,7 +364,7 @@ func (c *Action) Write(content string, values ...interface{}) error {
 // not be written to the response.
 func (c *Action) Abort(status int, body string) error {
 	c.StatusCode = status
-	return c.App.error(c.ResponseWriter, status, body)
+	return c.App.error(c.ResponseWriter, c.Request, status, body)
 }
 
 // Redirect is a helper method for 3xx redirects.
@@ -510,7 +530,7 @@ func (c *Action) Go(m string, anotherc ...interface{}) error {
 		return NotFound()
 	}
 
-	tagStr := tag.Tag.Get("xweb")
+	tagStr, _, _ := parseRouteOptions(tag.Tag.Get("xweb"))
 	var rPath string
 	if tagStr != "" {
 		p := tagStr
@@ -527,8 +547,9 @@ func (c *Action) Go(m string, anotherc ...interface{}) error {
 }
 
 func (c *Action) Flush() {
-	flusher, _ := c.ResponseWriter.(http.Flusher)
-	flusher.Flush()
+	if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
 }
 
 func (c *Action) BasePath() string {
@@ -589,9 +610,6 @@ func (c *Action) Panicf(format string, params ...interface{}) {
 
 // Include method provide to template for {{include "xx.tmpl"}}
 func (c *Action) Include(tmplName string) interface{} {
-	t := c.RootTemplate.New(tmplName)
-	t.Funcs(c.GetFuncs())
-
 	content, err := c.getTemplate(tmplName)
 	if err != nil {
 		c.Errorf("RenderTemplate %v read err: %s", tmplName, err)
@@ -603,13 +621,20 @@ func (c *Action) Include(tmplName string) interface{} {
 	if r, err := XHook.Call("BeforeRender", constr, c); err == nil {
 		constr = XHook.String(r[0])
 	}
-	tmpl, err := t.Parse(constr)
+	// a template set can't be parsed into once executing, so the
+	// included one is a set of its own
+	parsed, err := c.App.parseTemplates([]TemplateSource{{tmplName, constr}}, c.parseFuncs())
+	if err != nil {
+		c.Errorf("Parse %v err: %v", tmplName, err)
+		return ""
+	}
+	tmpl, err := parsed.Bind(template.FuncMap(c.f))
 	if err != nil {
 		c.Errorf("Parse %v err: %v", tmplName, err)
 		return ""
 	}
 	newbytes := bytes.NewBufferString("")
-	err = tmpl.Execute(newbytes, c.C.Elem().Interface())
+	err = tmpl.ExecuteTemplate(newbytes, tmplName, c.C.Elem().Interface())
 	if err != nil {
 		c.Errorf("Parse %v err: %v", tmplName, err)
 		return ""
@@ -625,77 +650,134 @@ func (c *Action) Include(tmplName string) interface{} {
 
 // render the template with vars map, you can have zero or one map
 func (c *Action) NamedRender(name, content string, params ...*T) error {
-	c.f["include"] = c.Include
+	return c.renderPage(name, content, false, params...)
+}
+
+// renderPage renders the page content within its layouts, see
+// SetLayout.
+func (c *Action) renderPage(name, content string, useDefaultLayout bool, params ...*T) error {
+	tplcontent, err := c.executePage(name, content, useDefaultLayout, params...)
+	if err != nil {
+		return err
+	}
+	return c.SetBody(tplcontent) //[SWH|+]
+}
+
+// requestFuncs returns the template funcs bound to the request, which
+// App.CheckTemplates also knows by their names. yield is replaced by
+// bindTemplates for the layouts.
+func (c *Action) requestFuncs() template.FuncMap {
+	funcs := template.FuncMap{
+		"include":        c.Include,
+		"cookie":         c.Cookie,
+		"XsrfFormHtml":   c.XsrfFormHtml,
+		"XsrfValue":      c.XsrfValue,
+		"T":              c.Tr,
+		"Lang":           c.Lang,
+		"FormatNumber":   c.FormatNumber,
+		"FormatCurrency": c.FormatCurrency,
+		"FormatPercent":  c.FormatPercent,
+		"FormatTime":     c.FormatTime,
+		"RelativeTime":   c.RelativeTime,
+		"yield":          unboundFunc("yield"),
+	}
 	if c.App.AppConfig.SessionOn {
-		c.f["session"] = c.GetSession
+		funcs["session"] = c.GetSession
+	}
+	return funcs
+}
+
+func (c *Action) executePage(name, content string, useDefaultLayout bool, params ...*T) ([]byte, error) {
+	for name, fn := range c.requestFuncs() {
+		c.f[name] = fn
 	}
-	c.f["cookie"] = c.Cookie
-	c.f["XsrfFormHtml"] = c.XsrfFormHtml
-	c.f["XsrfValue"] = c.XsrfValue
 	if len(params) > 0 {
 		c.AddTmplVars(params[0])
 	}
 
-	c.RootTemplate = template.New(name)
-	c.RootTemplate.Funcs(c.GetFuncs())
-
 	//[SWH|+]call hook
 	if r, err := XHook.Call("BeforeRender", content, c); err == nil {
 		content = XHook.String(r[0])
 	}
-	tmpl, err := c.RootTemplate.Parse(content)
-	if err == nil {
-		newbytes := bytes.NewBufferString("")
-		err = tmpl.Execute(newbytes, c.C.Elem().Interface())
-		if err == nil {
-			tplcontent, err := ioutil.ReadAll(newbytes)
-			if err == nil {
-				//[SWH|+]call hook
-				if r, err := XHook.Call("AfterRender", tplcontent, c); err == nil {
-					if ret := XHook.Value(r, 0); ret != nil {
-						tplcontent = ret.([]byte)
-					}
-				}
-				err = c.SetBody(tplcontent) //[SWH|+]
-				//_, err = c.ResponseWriter.Write(tplcontent)
-			}
+	chain, err := c.layoutChain(name, content, useDefaultLayout)
+	if err != nil {
+		return nil, err
+	}
+	tmpl, err := c.bindTemplates(chain)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if err = tmpl.ExecuteTemplate(&buf, chain[len(chain)-1].Name, c.C.Elem().Interface()); err != nil {
+		return nil, err
+	}
+	tplcontent := buf.Bytes()
+	//[SWH|+]call hook
+	if r, err := XHook.Call("AfterRender", tplcontent, c); err == nil {
+		if ret := XHook.Value(r, 0); ret != nil {
+			tplcontent = ret.([]byte)
 		}
 	}
-	return err
+	return tplcontent, nil
 }
 
 func (c *Action) getTemplate(tmpl string) ([]byte, error) {
 	if c.App.AppConfig.CacheTemplates {
 		return c.App.TemplateMgr.GetTemplate(tmpl)
 	}
-	path := c.App.getTemplatePath(tmpl)
-	if path == "" {
-		return nil, errors.New(fmt.Sprintf("No template file %v found", path))
+	content, err := fs.ReadFile(c.App.templateFS(), fsName(tmpl))
+	if err != nil {
+		return nil, errors.New(fmt.Sprintf("No template file %v found", tmpl))
 	}
-
-	return ioutil.ReadFile(path)
+	return content, nil
 }
 
 // render the template with vars map, you can have zero or one map
 func (c *Action) Render(tmpl string, params ...*T) error {
 	content, err := c.getTemplate(tmpl)
 	if err == nil {
-		err = c.NamedRender(tmpl, string(content), params...)
+		err = c.renderPage(tmpl, string(content), true, params...)
 	}
 	return err
 }
 
+// RenderBytes renders the template like Render but returns the content
+// instead of writing it, e.g. for the body of an email.
+func (c *Action) RenderBytes(tmpl string, params ...*T) ([]byte, error) {
+	content, err := c.getTemplate(tmpl)
+	if err != nil {
+		return nil, err
+	}
+	return c.executePage(tmpl, string(content), true, params...)
+}
+
+// GetFuncs returns the template funcs of the App together with the ones
+// of the request, like session or include, in a map of its own.
 func (c *Action) GetFuncs() template.FuncMap {
-	funcs := c.App.FuncMaps
-	if c.f != nil {
-		for k, v := range c.f {
-			funcs[k] = v
-		}
+	funcs := copyFuncMap(c.App.FuncMaps)
+	for k, v := range c.f {
+		funcs[k] = v
 	}
+	return funcs
+}
 
+// parseFuncs returns the funcs the templates are parsed with. Since the
+// parsed templates are shared by the requests, the funcs of the request
+// are placeholders, bound to it on the clone it executes.
+func (c *Action) parseFuncs() template.FuncMap {
+	funcs := copyFuncMap(c.App.FuncMaps)
+	for k := range c.f {
+		funcs[k] = unboundFunc(k)
+	}
 	return funcs
 }
 
+func unboundFunc(name string) func(...interface{}) (interface{}, error) {
+	return func(...interface{}) (interface{}, error) {
+		return nil, fmt.Errorf("template func %v is not defined for this request", name)
+	}
+}
+
 func (c *Action) SetConfig(name string, value interface{}) {
 	c.App.Config[name] = value
 }
@@ -738,15 +820,141 @@ func (c *Action) AddTmplVars(t *T) {
 	}
 }
 
-func (c *Action) ServeJson(obj interface{}) {
-	content, err := json.MarshalIndent(obj, "", "  ")
+// ServeJson writes obj as JSON, compact unless the request has a
+// pretty query parameter. When the request has a callback query
+// parameter allowed by AppConfig.JsonpCallbacks, it is wrapped as a
+// JSONP script; the parameter is ignored when JSONP is disabled. An
+// encoding error sends a 500 response.
+func (c *Action) ServeJson(obj interface{}) error {
+	var content []byte
+	var err error
+	if c.isPretty() {
+		content, err = json.MarshalIndent(obj, "", "  ")
+	} else {
+		content, err = json.Marshal(obj)
+	}
 	if err != nil {
-		http.Error(c.ResponseWriter, err.Error(), http.StatusInternalServerError)
-		return
+		c.Errorf("ServeJson: %v", err)
+		return c.Abort(http.StatusInternalServerError, "JSON encoding error")
 	}
-	c.SetHeader("Content-Length", strconv.Itoa(len(content)))
-	c.ResponseWriter.Header().Set("Content-Type", "application/json")
-	c.ResponseWriter.Write(content)
+
+	callback := c.Request.URL.Query().Get(JSONP_CALLBACK)
+	// the callback parameter means nothing when JSONP is disabled
+	if callback != "" && len(c.App.AppConfig.JsonpCallbacks) > 0 {
+		if !c.App.isJsonpCallback(callback) {
+			return c.Abort(http.StatusBadRequest, "invalid JSONP callback")
+		}
+		c.SetHeader("Content-Type", "application/javascript; charset=utf-8")
+		c.SetHeader("X-Content-Type-Options", "nosniff")
+		content = []byte("/**/" + callback + "(" + string(content) + ");")
+	} else {
+		c.SetHeader("Content-Type", "application/json; charset=utf-8")
+	}
+	return c.SetBody(content)
+}
+
+// isPretty returns whether the request asks for indented output with
+// ?pretty, ?pretty=1 or ?pretty=true.
+func (c *Action) isPretty() bool {
+	vals, ok := c.Request.URL.Query()["pretty"]
+	if !ok {
+		return false
+	}
+	if len(vals) == 0 || vals[0] == "" {
+		return true
+	}
+	pretty, _ := strconv.ParseBool(vals[0])
+	return pretty
+}
+
+// StreamJson writes the values received from src as soon as they are
+// available, flushing after each of them. src is a channel of any
+// element type or a func() (interface{}, bool) iterator returning false
+// when exhausted. Values are written as newline-delimited JSON, or as
+// the elements of a JSON array if asArray is true. Streaming stops when
+// the client goes away.
+// An encoding error on the first value sends a 500 response; later
+// errors cut the response short and are returned to be logged.
+func (c *Action) StreamJson(src interface{}, asArray ...bool) error {
+	array := len(asArray) > 0 && asArray[0]
+
+	var next func() (interface{}, bool)
+	switch it := src.(type) {
+	case func() (interface{}, bool):
+		next = it
+	default:
+		ch := reflect.ValueOf(src)
+		if ch.Kind() != reflect.Chan {
+			return fmt.Errorf("StreamJson: unsupported source %T", src)
+		}
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: ch},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(c.Request.Context().Done())},
+		}
+		next = func() (interface{}, bool) {
+			chosen, v, ok := reflect.Select(cases)
+			if chosen != 0 || !ok {
+				return nil, false
+			}
+			return v.Interface(), true
+		}
+	}
+
+	var count int
+	for {
+		if c.Request.Context().Err() != nil {
+			return nil
+		}
+		obj, ok := next()
+		if !ok {
+			break
+		}
+		content, err := json.Marshal(obj)
+		if err != nil {
+			c.Errorf("StreamJson: %v", err)
+			if count == 0 {
+				return c.Abort(http.StatusInternalServerError, "JSON encoding error")
+			}
+			// the status is already sent, leave the document unterminated
+			return &streamError{fmt.Errorf("StreamJson: %v", err)}
+		}
+
+		if count == 0 {
+			if array {
+				c.SetHeader("Content-Type", "application/json; charset=utf-8")
+				content = append([]byte("["), content...)
+			} else {
+				c.SetHeader("Content-Type", "application/x-ndjson; charset=utf-8")
+			}
+		} else if array {
+			content = append([]byte(","), content...)
+		}
+		if !array {
+			content = append(content, '\n')
+		}
+		if _, err = c.ResponseWriter.Write(content); err != nil {
+			return &streamError{err}
+		}
+		if flusher, ok := c.ResponseWriter.(http.Flusher); ok {
+			flusher.Flush()
+		}
+		count++
+	}
+
+	if array {
+		end := "]"
+		if count == 0 {
+			c.SetHeader("Content-Type", "application/json; charset=utf-8")
+			end = "[]"
+		}
+		if _, err := io.WriteString(c.ResponseWriter, end); err != nil {
+			return &streamError{err}
+		}
+	}
+	if count == 0 {
+		c.SetHeader("Content-Type", "application/x-ndjson; charset=utf-8")
+	}
+	return nil
 }
 
 func (c *Action) ServeXml(obj interface{}) {
@@ -823,6 +1031,23 @@ func (c *Action) Session() *httpsession.Session {
 	return c.session
 }
 
+// hasSession reports whether the request has a session, so that it can
+// be read without creating one for the clients having none.
+func (c *Action) hasSession() bool {
+	if !c.App.AppConfig.SessionOn || c.App.SessionManager == nil {
+		return false
+	}
+	if c.session != nil {
+		return true
+	}
+	name := c.App.AppConfig.SessionCookie
+	if name == "" {
+		name = DefaultSessionCookie
+	}
+	_, err := c.Request.Cookie(name)
+	return err == nil
+}
+
 func (c *Action) GetSession(key string) interface{} {
 	return c.Session().Get(key)
 }
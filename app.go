@@ -4,9 +4,9 @@ import (
 	"errors"
 	"fmt"
 	"html/template"
-	"io/ioutil"
+	"io/fs"
 	"net/http"
-	"os"
+	"net/url"
 	"path"
 	"path/filepath"
 	"reflect"
@@ -21,30 +21,41 @@ import (
 )
 
 const (
-	XSRF_TAG string = "_xsrf"
+	XSRF_TAG       string = "_xsrf"
+	JSONP_CALLBACK string = "callback"
+	// DefaultSessionCookie is the session id cookie of the default
+	// SessionManager.
+	DefaultSessionCookie string = "SESSIONID"
 )
 
 type App struct {
-	BasePath        string
-	Name            string //[SWH|+]
-	Routes          []Route
-	RoutesEq        map[string]map[string]Route
-	filters         []Filter
-	Server          *Server
-	AppConfig       *AppConfig
-	Config          map[string]interface{}
-	Actions         map[string]interface{}
-	ActionsPath     map[reflect.Type]string
-	ActionsNamePath map[string]string
-	FuncMaps        template.FuncMap
-	Logger          *log.Logger
-	VarMaps         T
-	SessionManager  *httpsession.Manager //Session manager
-	RootTemplate    *template.Template
-	ErrorTemplate   *template.Template
-	StaticVerMgr    *StaticVerMgr
-	TemplateMgr     *TemplateMgr
-	ContentEncoding string
+	BasePath         string
+	Name             string //[SWH|+]
+	Routes           []Route
+	RoutesEq         map[string]map[string]Route
+	filters          []Filter
+	Server           *Server
+	AppConfig        *AppConfig
+	Config           map[string]interface{}
+	Actions          map[string]interface{}
+	ActionsPath      map[reflect.Type]string
+	ActionsNamePath  map[string]string
+	FuncMaps         template.FuncMap
+	Logger           *log.Logger
+	VarMaps          T
+	SessionManager   *httpsession.Manager //Session manager
+	RootTemplate     *template.Template
+	ErrorTemplate    *template.Template
+	StaticVerMgr     *StaticVerMgr
+	TemplateMgr      *TemplateMgr
+	TemplateEngines  map[string]TemplateEngine // by file extension, see RegisterTemplateEngine
+	AssetMgr         *AssetMgr
+	I18n             *I18n
+	ErrorHandler     ErrorHandler // maps and reports the errors of the handlers
+	ContentEncoding  string       // Deprecated: the encoding is chosen per request
+	WebSocketOptions *WebSocketOptions
+	ResponseCache    *ResponseCache
+	encoders         []mediaEncoder
 }
 
 const (
@@ -58,14 +69,45 @@ type AppConfig struct {
 	TemplateDir       string
 	SessionOn         bool
 	MaxUploadSize     int64
+	MaxBodySize       int64 // limit of every request body, 0 means no limit
 	CookieSecret      string
 	StaticFileVersion bool
 	CacheTemplates    bool
 	ReloadTemplates   bool
 	CheckXsrf         bool
 	SessionTimeout    time.Duration
+	// SessionCookie is the name of the session id cookie,
+	// DefaultSessionCookie when empty.
+	SessionCookie     string
 	FormMapToStruct   bool //[SWH|+]
 	EnableHttpCache   bool //[SWH|+]
+	PrecompressStatic bool // write the .br and .gz files of the static dir at startup
+	// StaticFS and TemplateFS replace StaticDir and TemplateDir, e.g.
+	// to serve files embedded in the binary. Only the files of the disk
+	// are reloaded when they change.
+	StaticFS   fs.FS
+	TemplateFS fs.FS
+	// StaticPolicy controls what static files are served and how,
+	// DefaultStaticPolicy() when nil.
+	StaticPolicy *StaticPolicy
+	// StaticFingerprint makes StaticUrl insert the file version in the
+	// name, e.g. /js/app.3f9a1c2b.js, instead of a ?v= query. These
+	// names are served with far-future cache headers.
+	StaticFingerprint bool
+	// StaticManifest is a JSON manifest of the static file versions,
+	// see StaticVerMgr.ExportManifest, loaded instead of hashing the
+	// static files at startup.
+	StaticManifest string
+	// Layout is the default layout template of the pages of the same
+	// extension rendered by Action.Render, see Action.SetLayout.
+	Layout string
+	// JsonpCallbacks are the callback names ServeJson accepts for JSONP,
+	// a trailing * matches any suffix. JSONP is disabled when empty.
+	JsonpCallbacks []string
+	// LocaleDir is the dir of the locale files loaded into App.I18n at
+	// startup, LocaleFS replaces it like TemplateFS.
+	LocaleDir string
+	LocaleFS  fs.FS
 }
 
 type Route struct {
@@ -74,6 +116,85 @@ type Route struct {
 	HttpMethods    map[string]bool //GET POST HEAD DELETE etc.
 	HandlerMethod  string          //struct method name
 	HandlerElement reflect.Type    //handler element
+	Options        RouteOptions    //options given after the path in the xweb tag
+}
+
+// RouteOptions are the per-route settings appended to an xweb tag
+// after the path, e.g. `xweb:"POST /upload stream"`.
+type RouteOptions struct {
+	// Stream leaves the request body untouched so that the handler can
+	// read it with Action.MultipartReader instead of having it buffered
+	// by ParseMultipartForm.
+	Stream bool
+	// MaxBodySize overrides AppConfig.MaxBodySize, e.g. maxbody=100MB.
+	// 0 keeps the App's limit and a negative value removes it.
+	MaxBodySize int64
+	// WebSocket is set for routes tagged with the WS method, they only
+	// serve WebSocket upgrade requests.
+	WebSocket bool
+	// CacheTTL stores the GET responses in the App's ResponseCache,
+	// e.g. cache=5m. CacheStale, e.g. stale=1m, serves them once expired
+	// while they are regenerated, and CacheVary, e.g.
+	// vary=Accept-Language,session, keeps one response per value of
+	// these request headers. See Action.CacheFor.
+	CacheTTL   time.Duration
+	CacheStale time.Duration
+	CacheVary  []string
+}
+
+// parseRouteOptions removes the option tokens from an xweb tag and
+// returns the remaining "METHODS PATH" part together with the options.
+// The invalid options are skipped, the first one being reported.
+func parseRouteOptions(tagStr string) (string, RouteOptions, error) {
+	var opts RouteOptions
+	var rest []string
+	var err error
+	fail := func(format string, args ...interface{}) {
+		if err == nil {
+			err = fmt.Errorf(format, args...)
+		}
+	}
+	for _, tok := range strings.Fields(tagStr) {
+		kv := strings.SplitN(tok, "=", 2)
+		switch strings.ToLower(kv[0]) {
+		case "stream":
+			opts.Stream = true
+		case "maxbody":
+			if len(kv) != 2 {
+				fail("route option %v needs a value", tok)
+				continue
+			}
+			if n, e := strconv.ParseInt(kv[1], 10, 64); e == nil && n < 0 {
+				opts.MaxBodySize = -1
+			} else if size, e := parseByteSize(kv[1]); e != nil {
+				fail("route option %v: %v", tok, e)
+			} else {
+				opts.MaxBodySize = size
+			}
+		case "cache", "stale":
+			if len(kv) != 2 {
+				fail("route option %v needs a value", tok)
+				continue
+			}
+			d, e := time.ParseDuration(kv[1])
+			if e != nil {
+				fail("route option %v: %v", tok, e)
+			} else if strings.ToLower(kv[0]) == "cache" {
+				opts.CacheTTL = d
+			} else {
+				opts.CacheStale = d
+			}
+		case "vary":
+			if len(kv) != 2 {
+				fail("route option %v needs a value", tok)
+				continue
+			}
+			opts.CacheVary = append(opts.CacheVary, strings.Split(kv[1], ",")...)
+		default:
+			rest = append(rest, tok)
+		}
+	}
+	return strings.Join(rest, " "), opts, err
 }
 
 func NewApp(args ...string) *App {
@@ -100,29 +221,47 @@ func NewApp(args ...string) *App {
 			ReloadTemplates:   true,
 			CheckXsrf:         true,
 			FormMapToStruct:   true,
+			StaticPolicy:      DefaultStaticPolicy(),
 		},
-		Config:          map[string]interface{}{},
-		Actions:         map[string]interface{}{},
-		ActionsPath:     map[reflect.Type]string{},
-		ActionsNamePath: map[string]string{},
-		FuncMaps:        defaultFuncs,
-		VarMaps:         T{},
-		filters:         make([]Filter, 0),
-		StaticVerMgr:    new(StaticVerMgr),
-		TemplateMgr:     new(TemplateMgr),
+		Config:           map[string]interface{}{},
+		Actions:          map[string]interface{}{},
+		ActionsPath:      map[reflect.Type]string{},
+		ActionsNamePath:  map[string]string{},
+		FuncMaps:         copyFuncMap(defaultFuncs),
+		VarMaps:          T{},
+		filters:          make([]Filter, 0),
+		StaticVerMgr:     new(StaticVerMgr),
+		TemplateMgr:      new(TemplateMgr),
+		TemplateEngines:  defaultTemplateEngines(),
+		AssetMgr:         new(AssetMgr),
+		I18n:             NewI18n("en"),
+		WebSocketOptions: defaultWebSocketOptions(),
+		encoders:         defaultEncoders(),
 	}
 }
 
 func (a *App) initApp() {
+	a.AssetMgr.Init(a)
 	if a.AppConfig.StaticFileVersion {
 		a.StaticVerMgr.Init(a, a.AppConfig.StaticDir)
 	}
 	if a.AppConfig.CacheTemplates {
 		a.TemplateMgr.Init(a, a.AppConfig.TemplateDir, a.AppConfig.ReloadTemplates)
 	}
-	a.FuncMaps["StaticUrl"] = a.StaticUrl
-	a.FuncMaps["XsrfName"] = XsrfName
+	if a.AppConfig.PrecompressStatic {
+		if n, err := a.Precompress(); err != nil {
+			a.Warn("precompress static files:", err)
+		} else if n > 0 {
+			a.Info("precompressed", n, "static files")
+		}
+	}
+	a.initFuncs()
 	a.VarMaps["XwebVer"] = Version
+	if a.AppConfig.LocaleDir != "" || a.AppConfig.LocaleFS != nil {
+		if err := a.I18n.LoadFS(a.localeFS(), "."); err != nil {
+			a.Warn("load locales:", err)
+		}
+	}
 
 	if a.AppConfig.SessionOn {
 		if a.Server.SessionManager != nil {
@@ -141,6 +280,13 @@ func (a *App) initApp() {
 	}
 }
 
+// initFuncs adds the template funcs of the App.
+func (a *App) initFuncs() {
+	a.FuncMaps["StaticUrl"] = a.StaticUrl
+	a.FuncMaps["AssetTags"] = a.AssetTags
+	a.FuncMaps["XsrfName"] = XsrfName
+}
+
 func (a *App) SetStaticDir(dir string) {
 	a.AppConfig.StaticDir = dir
 }
@@ -149,14 +295,6 @@ func (a *App) SetTemplateDir(path string) {
 	a.AppConfig.TemplateDir = path
 }
 
-func (a *App) getTemplatePath(name string) string {
-	templateFile := path.Join(a.AppConfig.TemplateDir, name)
-	if fileExists(templateFile) {
-		return templateFile
-	}
-	return ""
-}
-
 func (app *App) SetConfig(name string, val interface{}) {
 	app.Config[name] = val
 }
@@ -265,24 +403,48 @@ func (app *App) filter(w http.ResponseWriter, req *http.Request) bool {
 	return true
 }
 
-func (a *App) addRoute(r string, methods map[string]bool, t reflect.Type, handler string) {
+func (a *App) addRoute(r string, methods map[string]bool, t reflect.Type, handler string, opts RouteOptions) {
 	cr, err := regexp.Compile(r)
 	if err != nil {
 		a.Errorf("Error in route regex %q: %s", r, err)
 		return
 	}
-	a.Routes = append(a.Routes, Route{Path: r, CompiledRegexp: cr, HttpMethods: methods, HandlerMethod: handler, HandlerElement: t})
+	a.Routes = append(a.Routes, Route{Path: r, CompiledRegexp: cr, HttpMethods: methods, HandlerMethod: handler, HandlerElement: t, Options: opts})
 }
 
-func (a *App) addEqRoute(r string, methods map[string]bool, t reflect.Type, handler string) {
+func (a *App) addEqRoute(r string, methods map[string]bool, t reflect.Type, handler string, opts RouteOptions) {
 	if _, ok := a.RoutesEq[r]; !ok {
 		a.RoutesEq[r] = make(map[string]Route)
 	}
 	for v, _ := range methods {
-		a.RoutesEq[r][v] = Route{HandlerMethod: handler, HandlerElement: t}
+		a.RoutesEq[r][v] = Route{HandlerMethod: handler, HandlerElement: t, Options: opts}
 	}
 }
 
+// findRoute returns the first route matching reqPath and method without
+// running it, with the arguments of its handler.
+func (a *App) findRoute(reqPath, method string) (Route, []reflect.Value, bool) {
+	if routes, ok := a.RoutesEq[reqPath]; ok {
+		if route, ok := routes[method]; ok {
+			return route, nil, true
+		}
+	}
+	for _, route := range a.Routes {
+		if _, ok := route.HttpMethods[method]; !ok {
+			continue
+		}
+		match := route.CompiledRegexp.FindStringSubmatch(reqPath)
+		if len(match) > 0 && len(match[0]) == len(reqPath) {
+			var args []reflect.Value
+			for _, arg := range match[1:] {
+				args = append(args, reflect.ValueOf(arg))
+			}
+			return route, args, true
+		}
+	}
+	return Route{}, nil, false
+}
+
 var (
 	mapperType = reflect.TypeOf(Mapper{})
 )
@@ -304,7 +466,10 @@ func (app *App) AddRouter(url string, c interface{}) {
 		}
 
 		tag := t.Field(i).Tag
-		tagStr := tag.Get("xweb")
+		tagStr, opts, err := parseRouteOptions(tag.Get("xweb"))
+		if err != nil {
+			app.Warnf("%v.%v: %v", t.Name(), name, err)
+		}
 		methods := map[string]bool{"GET": true, "POST": true}
 		var p string
 		var isEq bool
@@ -338,41 +503,41 @@ func (app *App) AddRouter(url string, c interface{}) {
 				isEq = true
 			}
 			p = strings.TrimRight(url, "/") + path
+			if methods["WS"] {
+				opts.WebSocket = true
+				methods = map[string]bool{"WS": true}
+			}
 		} else {
 			p = strings.TrimRight(url, "/") + "/" + name
 			isEq = true
 		}
 		if isEq {
-			app.addEqRoute(removeStick(p), methods, t, a)
+			app.addEqRoute(removeStick(p), methods, t, a, opts)
 		} else {
-			app.addRoute(removeStick(p), methods, t, a)
+			app.addRoute(removeStick(p), methods, t, a, opts)
 		}
 	}
 }
 
 // the main route handler in web.go
 func (a *App) routeHandler(req *http.Request, w http.ResponseWriter) {
+	req = withRequestId(req, w)
+	if a.I18n.URLPrefix {
+		req = a.I18n.stripPrefix(a.BasePath, req)
+	}
 	requestPath := req.URL.Path
 	var statusCode = 0
 	defer func() {
 		if statusCode == 0 {
 			statusCode = 200
 		}
-		if statusCode >= 200 && statusCode < 400 {
+		if statusCode < 400 {
 			a.Info(req.Method, statusCode, requestPath)
 		} else {
 			a.Error(req.Method, statusCode, requestPath)
 		}
 	}()
 
-	//ignore errors from ParseForm because it's usually harmless.
-	ct := req.Header.Get("Content-Type")
-	if strings.Contains(ct, "multipart/form-data") {
-		req.ParseMultipartForm(a.AppConfig.MaxUploadSize)
-	} else {
-		req.ParseForm()
-	}
-
 	//set some default headers
 	w.Header().Set("Server", "xweb")
 	tm := time.Now().UTC()
@@ -387,7 +552,7 @@ func (a *App) routeHandler(req *http.Request, w http.ResponseWriter) {
 		}
 		if requestPath == "/favicon.ico" {
 			statusCode = 404
-			a.error(w, 404, "Page not found")
+			a.error(w, req, 404, "Page not found")
 			return
 		}
 	}
@@ -400,49 +565,55 @@ func (a *App) routeHandler(req *http.Request, w http.ResponseWriter) {
 	}
 	requestPath = req.URL.Path //[SWH|+]support filter change req.URL.Path
 
+	// the route is resolved once the filters rewrote the path, its
+	// options apply to the body of the request
 	reqPath := removeStick(requestPath)
 	allowMethod := Ternary(req.Method == "HEAD", "GET", req.Method).(string)
-	isFind := false
-	if routes, ok := a.RoutesEq[reqPath]; ok {
-		if route, ok := routes[allowMethod]; ok {
-			var isBreak bool = false
-			var args []reflect.Value
-			isBreak, statusCode = a.run(req, w, route, args)
-			if isBreak {
-				return
-			}
-			isFind = true
+	if _, _, ok := a.findRoute(reqPath, "WS"); ok {
+		// a plain GET of a WebSocket only route is answered with a 426
+		if isWebSocketUpgrade(req) {
+			allowMethod = "WS"
+		} else if _, _, ok := a.findRoute(reqPath, allowMethod); !ok && allowMethod == "GET" {
+			allowMethod = "WS"
 		}
 	}
-	if !isFind {
-		for _, route := range a.Routes {
-			cr := route.CompiledRegexp
-
-			//if the methods don't match, skip this handler (except HEAD can be used in place of GET)
-			if _, ok := route.HttpMethods[allowMethod]; !ok {
-				continue
-			}
-
-			if !cr.MatchString(reqPath) {
-				continue
-			}
+	route, args, hasRoute := a.findRoute(reqPath, allowMethod)
 
-			match := cr.FindStringSubmatch(reqPath)
+	maxBodySize := a.AppConfig.MaxBodySize
+	if hasRoute && route.Options.MaxBodySize != 0 {
+		maxBodySize = route.Options.MaxBodySize
+	}
+	if maxBodySize > 0 {
+		if req.ContentLength > maxBodySize {
+			statusCode = http.StatusRequestEntityTooLarge
+			a.error(w, req, statusCode, "Request body too large")
+			return
+		}
+		req.Body = http.MaxBytesReader(w, req.Body, maxBodySize)
+	}
 
-			if len(match[0]) != len(reqPath) {
-				continue
-			}
+	//ignore errors from ParseForm because it's usually harmless.
+	ct := req.Header.Get("Content-Type")
+	var err error
+	if hasRoute && route.Options.Stream {
+		// leave the body to the handler, only the query string is parsed;
+		// an empty PostForm keeps FormValue from parsing the body.
+		req.Form = req.URL.Query()
+		req.PostForm = url.Values{}
+	} else if strings.Contains(ct, "multipart/form-data") {
+		err = req.ParseMultipartForm(a.AppConfig.MaxUploadSize)
+	} else {
+		err = req.ParseForm()
+	}
+	if isBodyTooLarge(err) {
+		statusCode = http.StatusRequestEntityTooLarge
+		a.error(w, req, statusCode, "Request body too large")
+		return
+	}
 
-			var args []reflect.Value
-			for _, arg := range match[1:] {
-				args = append(args, reflect.ValueOf(arg))
-			}
-			var isBreak bool = false
-			isBreak, statusCode = a.run(req, w, route, args)
-			if isBreak {
-				return
-			}
-		}
+	if hasRoute {
+		_, statusCode = a.run(req, w, route, args)
+		return
 	}
 	// try serving index.html or index.htm
 	if req.Method == "GET" || req.Method == "HEAD" {
@@ -452,10 +623,13 @@ func (a *App) routeHandler(req *http.Request, w http.ResponseWriter) {
 		} else if a.TryServingFile(path.Join(requestPath, "index.htm"), req, w) {
 			statusCode = 200
 			return
+		} else if a.serveDirIndex(requestPath, req, w) || a.serveSpaIndex(requestPath, req, w) {
+			statusCode = 200
+			return
 		}
 	}
 
-	a.error(w, 404, "Page not found")
+	a.error(w, req, 404, "Page not found")
 	statusCode = 404
 }
 
@@ -509,7 +683,7 @@ func (a *App) run(req *http.Request, w http.ResponseWriter, route Route, args []
 			formVal = formVals[0]
 		}
 		if err != nil || res.Value == "" || res.Value != formVal {
-			a.error(w, 500, "xsrf token error.")
+			a.error(w, req, 500, "xsrf token error.")
 			a.Error("xsrf token error.")
 			statusCode = 500
 			isBreak = true
@@ -529,15 +703,40 @@ func (a *App) run(req *http.Request, w http.ResponseWriter, route Route, args []
 		}
 	}
 
+	if route.Options.WebSocket {
+		return a.runWebSocket(c, vc, route, args)
+	}
+
+	defer func() {
+		// the response can't be written once the handler returned
+		if c.eventStream != nil {
+			c.eventStream.Close()
+		}
+	}()
+
+	if a.ResponseCache != nil && (req.Method == "GET" || req.Method == "HEAD") {
+		if route.Options.CacheTTL > 0 {
+			c.CacheFor(route.Options.CacheTTL, route.Options.CacheStale)
+			c.CacheVary(route.Options.CacheVary...)
+		}
+		if a.ResponseCache.cached(&route) && a.ResponseCache.serve(c, &route, args) {
+			statusCode = c.StatusCode
+			isBreak = true
+			return
+		}
+		defer func() {
+			if c.cacheWriter != nil {
+				a.ResponseCache.store(c, c.cacheWriter, &route)
+			}
+		}()
+	}
+
 	ret, err := a.SafelyCall(vc, route.HandlerMethod, args)
+	// the response is recorded once the handler called CacheFor
+	w = c.ResponseWriter
 	if err != nil {
 		//there was an error or panic while calling the handler
-		if a.AppConfig.Mode == Debug {
-			a.error(w, 500, fmt.Sprintf("<pre>handler error: %v</pre>", err))
-		} else if a.AppConfig.Mode == Product {
-			a.error(w, 500, "Server Error")
-		}
-		statusCode = 500
+		statusCode = a.handleError(c, err)
 		isBreak = true
 		return
 	}
@@ -577,16 +776,12 @@ func (a *App) run(req *http.Request, w http.ResponseWriter, route Route, args []
 	} else if sval.Kind() == reflect.Slice && sval.Type().Elem().Kind() == reflect.Uint8 {
 		content = sval.Interface().([]byte)
 	} else if err, ok := sval.Interface().(error); ok {
-		if err != nil {
-			a.Error("Error:", err)
-			a.error(w, 500, "Server Error")
-			statusCode = 500
-		}
+		statusCode = a.handleError(c, err)
 		isBreak = true
 		return
 	} else {
-		a.Warn("unkonw returned result type %v, ignored %v", sval,
-			sval.Interface().(error))
+		a.Warn("unkonw returned result type %v, ignored %v", sval.Type(),
+			sval.Interface())
 
 		isBreak = true
 		return
@@ -597,38 +792,69 @@ func (a *App) run(req *http.Request, w http.ResponseWriter, route Route, args []
 	if err != nil {
 		a.Error("Error during write: %v", err)
 		statusCode = 500
-		isBreak = true
+	}
+	isBreak = true
+	return
+}
+
+// runWebSocket upgrades the connection once the filters, the session
+// lookup and the Before hook passed, then calls the handler.
+func (a *App) runWebSocket(c *Action, vc reflect.Value, route Route, args []reflect.Value) (isBreak bool, statusCode int) {
+	isBreak = true
+	if a.AppConfig.SessionOn && a.SessionManager != nil {
+		// the session cookie is sent with the handshake response
+		c.Session()
+	}
+	ws, err := c.upgradeWebSocket()
+	if err != nil {
+		a.Warn(err)
+		statusCode = a.handleError(c, err)
 		return
 	}
+	c.webSocket = ws
+	statusCode = http.StatusSwitchingProtocols
+
+	ret, err := a.SafelyCall(vc, route.HandlerMethod, args)
+	if err == nil && len(ret) > 0 {
+		if e, ok := ret[0].Interface().(error); ok && e != nil {
+			err = e
+		}
+	}
+	if err != nil {
+		a.Error("websocket handler error:", err)
+		ws.Close(CloseInternalServerErr, "")
+	} else {
+		ws.Close(CloseNormalClosure, "")
+	}
 	return
 }
 
-func (a *App) error(w http.ResponseWriter, status int, content string) error {
-	w.WriteHeader(status)
-	if errorTmpl == "" {
-		errTmplFile := a.AppConfig.TemplateDir + "/_error.html"
-		if file, err := os.Stat(errTmplFile); err == nil && !file.IsDir() {
-			if b, e := ioutil.ReadFile(errTmplFile); e == nil {
-				errorTmpl = string(b)
-			}
+var jsonpCallbackRegexp = regexp.MustCompile(`^[a-zA-Z_$][a-zA-Z0-9_$]*(\.[a-zA-Z_$][a-zA-Z0-9_$]*)*$`)
+
+func (a *App) isJsonpCallback(name string) bool {
+	if !jsonpCallbackRegexp.MatchString(name) {
+		return false
+	}
+	for _, allowed := range a.AppConfig.JsonpCallbacks {
+		if allowed == name {
+			return true
 		}
-		if errorTmpl == "" {
-			errorTmpl = defaultErrorTmpl
+		if strings.HasSuffix(allowed, "*") && strings.HasPrefix(name, allowed[:len(allowed)-1]) {
+			return true
 		}
 	}
-	res := fmt.Sprintf(errorTmpl, status, statusText[status],
-		status, statusText[status], content, Version)
-	_, err := w.Write([]byte(res))
-	return err
+	return false
 }
 
-func (a *App) StaticUrl(url string) string {
-	var basePath string
+func (a *App) staticBasePath() string {
 	if a.AppConfig.StaticDir == RootApp().AppConfig.StaticDir {
-		basePath = RootApp().BasePath
-	} else {
-		basePath = a.BasePath
+		return RootApp().BasePath
 	}
+	return a.BasePath
+}
+
+func (a *App) StaticUrl(url string) string {
+	basePath := a.staticBasePath()
 	if !a.AppConfig.StaticFileVersion {
 		return path.Join(basePath, url)
 	}
@@ -636,6 +862,9 @@ func (a *App) StaticUrl(url string) string {
 	if ver == "" {
 		return path.Join(basePath, url)
 	}
+	if a.AppConfig.StaticFingerprint {
+		return path.Join(basePath, fingerprintName(url, ver))
+	}
 	return path.Join(basePath, url+"?v="+ver)
 }
 
@@ -648,19 +877,16 @@ func (a *App) SafelyCall(vc reflect.Value, method string, args []reflect.Value)
 				panic(e)
 			} else {
 				resp = nil
-				var content string
-				content = fmt.Sprintf("Handler crashed with error: %v", e)
+				var stack []string
 				for i := 1; ; i += 1 {
 					_, file, line, ok := runtime.Caller(i)
 					if !ok {
 						break
-					} else {
-						content += "\n"
 					}
-					content += fmt.Sprintf("%v %v", file, line)
+					stack = append(stack, fmt.Sprintf("%v %v", file, line))
 				}
-				a.Error(content)
-				err = errors.New(content)
+				err = &PanicError{e, strings.Join(stack, "\n")}
+				a.Error(err.Error())
 				return
 			}
 		}
@@ -669,12 +895,11 @@ func (a *App) SafelyCall(vc reflect.Value, method string, args []reflect.Value)
 	return function.Call(args), err
 }
 
-// Init content-length header.
-func (a *App) InitHeadContent(w http.ResponseWriter, contentLength int64) {
-	if a.ContentEncoding == "gzip" {
-		w.Header().Set("Content-Encoding", "gzip")
-	} else if a.ContentEncoding == "deflate" {
-		w.Header().Set("Content-Encoding", "deflate")
+// Init content-length header, or the Content-Encoding of a response
+// compressed with encoding.
+func (a *App) InitHeadContent(w http.ResponseWriter, encoding string, contentLength int64) {
+	if encoding != "" {
+		w.Header().Set("Content-Encoding", encoding)
 	} else {
 		w.Header().Set("Content-Length", strconv.FormatInt(contentLength, 10))
 	}
@@ -687,12 +912,41 @@ func (a *App) TryServingFile(name string, req *http.Request, w http.ResponseWrit
 	if strings.HasPrefix(name, a.BasePath) {
 		newPath = name[len(a.BasePath):]
 	}
-	staticFile := filepath.Join(a.AppConfig.StaticDir, newPath)
-	finfo, err := os.Stat(staticFile)
-	if err != nil {
+	fsys := a.staticFS()
+	staticFile := fsName(newPath)
+	policy := a.staticPolicy()
+	if policy.Denied(staticFile) {
 		return false
 	}
+	if a.serveAsset(staticFile, req, w) {
+		return true
+	}
+	finfo, err := fs.Stat(fsys, staticFile)
+	immutable := false
+	if err != nil {
+		if !a.AppConfig.StaticFileVersion || !a.AppConfig.StaticFingerprint {
+			return false
+		}
+		orig, ok := a.StaticVerMgr.Unfingerprint(staticFile)
+		// the fingerprinted name must not get around the deny rules
+		if !ok || policy.Denied(orig) {
+			return false
+		}
+		if finfo, err = fs.Stat(fsys, orig); err != nil {
+			return false
+		}
+		staticFile, newPath, immutable = orig, orig, true
+	}
 	if !finfo.IsDir() {
+		policy.setHeaders(w.Header(), staticFile)
+		if immutable {
+			// the name changes with the content
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			w.Header().Set("Expires", webTime(time.Now().UTC().AddDate(1, 0, 0)))
+		}
+		if a.Server.Config.EnableGzip && a.servePrecompressed(fsys, staticFile, finfo, req, w) {
+			return true
+		}
 		isStaticFileToCompress := false
 		if a.Server.Config.EnableGzip && a.Server.Config.StaticExtensionsToGzip != nil && len(a.Server.Config.StaticExtensionsToGzip) > 0 {
 			for _, statExtension := range a.Server.Config.StaticExtensionsToGzip {
@@ -702,16 +956,24 @@ func (a *App) TryServingFile(name string, req *http.Request, w http.ResponseWrit
 				}
 			}
 		}
+		dir, onDisk := isDiskFS(fsys)
 		if isStaticFileToCompress {
-			a.ContentEncoding = GetAcceptEncodingZip(req)
-			memzipfile, err := OpenMemZipFile(staticFile, a.ContentEncoding)
+			addVary(w.Header(), "Accept-Encoding")
+			encoding := a.acceptEncoding(req, finfo.Size())
+			key := filepath.Join(dir, newPath)
+			if !onDisk {
+				key = a.Name + ":" + staticFile
+			}
+			memzipfile, err := openMemZipFile(fsys, staticFile, key, encoding)
 			if err != nil {
 				return false
 			}
-			a.InitHeadContent(w, finfo.Size())
+			a.InitHeadContent(w, encoding, finfo.Size())
 			http.ServeContent(w, req, staticFile, finfo.ModTime(), memzipfile)
-		} else {
-			http.ServeFile(w, req, staticFile)
+		} else if onDisk {
+			http.ServeFile(w, req, filepath.Join(dir, newPath))
+		} else if err := serveFSFile(w, req, fsys, staticFile, finfo); err != nil {
+			return false
 		}
 		return true
 	}
@@ -0,0 +1,138 @@
+package xweb
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-xweb/log"
+)
+
+func TestParseRouteOptions(t *testing.T) {
+	tests := []struct {
+		tag     string
+		rest    string
+		maxBody int64
+	}{
+		{"POST /upload maxbody=10MB", "POST /upload", 10 << 20},
+		{"POST /upload stream maxbody=-1", "POST /upload", -1},
+		{"POST /upload maxbody=-100", "POST /upload", -1},
+		{"/plain", "/plain", 0},
+	}
+	for _, test := range tests {
+		rest, opts, err := parseRouteOptions(test.tag)
+		if err != nil || rest != test.rest || opts.MaxBodySize != test.maxBody {
+			t.Errorf("parseRouteOptions(%q) = %q, %v, %v", test.tag, rest, opts.MaxBodySize, err)
+		}
+	}
+	for _, tag := range []string{"POST /upload maxbody", "POST /upload maxbody=big", "POST /upload maxbody=-1.5"} {
+		if _, _, err := parseRouteOptions(tag); err == nil {
+			t.Errorf("parseRouteOptions(%q) should fail", tag)
+		}
+	}
+
+	// a valid maxbody doesn't hide an invalid option, which is skipped
+	rest, opts, err := parseRouteOptions("GET /list cache=soon maxbody=1KB stale=1m")
+	if err == nil || !strings.Contains(err.Error(), "cache=soon") {
+		t.Errorf("got error %v, want the one of cache=soon", err)
+	}
+	if rest != "GET /list" || opts.MaxBodySize != 1<<10 || opts.CacheStale != time.Minute || opts.CacheTTL != 0 {
+		t.Errorf("unexpected %q %+v", rest, opts)
+	}
+	if _, _, err := parseRouteOptions("GET /list maxbody=big cache=soon"); err == nil || !strings.Contains(err.Error(), "maxbody=big") {
+		t.Errorf("got error %v, want the first one", err)
+	}
+}
+
+type maxBodyAction struct {
+	*Action
+	form      Mapper `xweb:"POST /form"`
+	small     Mapper `xweb:"POST /small maxbody=10"`
+	unlimited Mapper `xweb:"POST /unlimited stream maxbody=-1"`
+	stream    Mapper `xweb:"POST /stream stream"`
+}
+
+func (c *maxBodyAction) Init() {
+	c.Option.CheckXsrf = false
+}
+
+func (c *maxBodyAction) Form() string {
+	return c.Request.FormValue("a")
+}
+
+func (c *maxBodyAction) Small() string {
+	return c.Request.FormValue("a")
+}
+
+func (c *maxBodyAction) Unlimited() error {
+	_, err := io.Copy(ioutil.Discard, c.Request.Body)
+	return err
+}
+
+func (c *maxBodyAction) Stream() error {
+	_, err := io.Copy(ioutil.Discard, c.Request.Body)
+	return err
+}
+
+// rewriteFilter moves the requests of its old paths to the new ones.
+type rewriteFilter map[string]string
+
+func (f rewriteFilter) Do(w http.ResponseWriter, req *http.Request) bool {
+	if p, ok := f[req.URL.Path]; ok {
+		req.URL.Path = p
+	}
+	return true
+}
+
+func TestMaxBodySize(t *testing.T) {
+	s := NewServer("maxbody")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.RootApp.AppConfig.MaxBodySize = 100
+	s.AddAction(&maxBodyAction{})
+	s.RootApp.AddFilter(rewriteFilter{"/old/small": "/small", "/old/unlimited": "/unlimited"})
+	s.initServer()
+
+	post := func(path, body string, chunked bool) int {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if chunked {
+			// the size is only known once the body is read
+			req.ContentLength = -1
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	large := "a=" + strings.Repeat("x", 200)
+	tests := []struct {
+		path    string
+		body    string
+		chunked bool
+		status  int
+	}{
+		{"/form", "a=1", false, 200},
+		{"/form", large, false, 413},
+		// ParseForm hits the limit
+		{"/form", large, true, 413},
+		{"/small", "a=123456789", false, 413},
+		{"/small", "a=123456789", true, 413},
+		{"/small", "a=1", true, 200},
+		{"/unlimited", large, true, 200},
+		// the handler hits the limit of MaxBytesReader
+		{"/stream", large, true, 413},
+		{"/stream", "a=1", true, 200},
+		// the options of the route the filters rewrote the path to
+		{"/old/small", "a=123456789", false, 413},
+		{"/old/unlimited", large, true, 200},
+	}
+	for _, test := range tests {
+		if status := post(test.path, test.body, test.chunked); status != test.status {
+			t.Errorf("POST %v with %v bytes (chunked %v) = %v, want %v", test.path, len(test.body), test.chunked, status, test.status)
+		}
+	}
+}
@@ -0,0 +1,289 @@
+package xweb
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Bundle is a static asset, e.g. app.css, made of several static files
+// concatenated at startup and again when one of them changes.
+type Bundle struct {
+	Name  string   // the served name, whose extension gives the type
+	Files []string // the static files, in order
+	// Minify removes the comments and whitespace of the .css, .js and
+	// .html bundles, it's set by AddBundle.
+	Minify bool
+
+	built *builtBundle
+}
+
+// builtBundle is the content of a Bundle, replaced when it's rebuilt.
+type builtBundle struct {
+	name    string
+	content []byte
+	ver     string
+	modTime time.Time
+	zipped  map[string][]byte // guarded by AssetMgr.mutex
+}
+
+var minifiers = map[string]func([]byte) []byte{
+	".css":  MinifyCSS,
+	".js":   MinifyJS,
+	".html": MinifyHTML,
+	".htm":  MinifyHTML,
+}
+
+// AssetMgr keeps the asset bundles of an App.
+type AssetMgr struct {
+	mutex   sync.Mutex
+	bundles map[string]*Bundle
+	app     *App
+}
+
+// Add declares the bundle name made of the static files, replacing any
+// bundle of the same name.
+func (self *AssetMgr) Add(name string, files ...string) *Bundle {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	if self.bundles == nil {
+		self.bundles = make(map[string]*Bundle)
+	}
+	b := &Bundle{Name: strings.TrimPrefix(name, "/"), Files: files, Minify: true}
+	self.bundles[b.Name] = b
+	return b
+}
+
+// Init builds the bundles, reporting the missing files.
+func (self *AssetMgr) Init(app *App) {
+	self.app = app
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for _, b := range self.bundles {
+		if err := self.build(b); err != nil {
+			app.Warnf("build asset bundle %v failed: %v", b.Name, err)
+		}
+	}
+}
+
+func (self *AssetMgr) build(b *Bundle) error {
+	fsys := self.app.staticFS()
+	var buf bytes.Buffer
+	var modTime time.Time
+	for _, file := range b.Files {
+		content, err := fs.ReadFile(fsys, fsName(file))
+		if err != nil {
+			return err
+		}
+		if info, err := fs.Stat(fsys, fsName(file)); err == nil && info.ModTime().After(modTime) {
+			modTime = info.ModTime()
+		}
+		buf.Write(content)
+		if path.Ext(b.Name) == ".js" {
+			// a file may end without its last semicolon
+			buf.WriteString(";")
+		}
+		buf.WriteString("\n")
+	}
+	content := buf.Bytes()
+	if minify, ok := minifiers[strings.ToLower(path.Ext(b.Name))]; ok && b.Minify {
+		content = minify(content)
+	}
+
+	h := md5.New()
+	h.Write(content)
+	b.built = &builtBundle{
+		name:    b.Name,
+		content: content,
+		ver:     fmt.Sprintf("%x", h.Sum(nil))[0:8],
+		modTime: modTime,
+		zipped:  make(map[string][]byte),
+	}
+	self.app.Debug("built asset bundle ", b.Name)
+	return nil
+}
+
+// get returns the content of the bundle name, building it if needed.
+func (self *AssetMgr) get(name string) (*builtBundle, error) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	b, ok := self.bundles[name]
+	if !ok {
+		return nil, fmt.Errorf("no asset bundle %v", name)
+	}
+	if b.built == nil {
+		if err := self.build(b); err != nil {
+			return nil, err
+		}
+	}
+	return b.built, nil
+}
+
+// Changed rebuilds the bundles made of the static file url.
+func (self *AssetMgr) Changed(url string) {
+	url = strings.TrimPrefix(filepath.ToSlash(url), "/")
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for _, b := range self.bundles {
+		for _, file := range b.Files {
+			if strings.TrimPrefix(file, "/") == url {
+				if err := self.build(b); err != nil {
+					b.built = nil
+					self.app.Warnf("build asset bundle %v failed: %v", b.Name, err)
+				}
+				break
+			}
+		}
+	}
+}
+
+func (self *AssetMgr) has(name string) bool {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	_, ok := self.bundles[name]
+	return ok
+}
+
+// matches returns the sorted names of the bundles of name, e.g.
+// app.css and app.js for app.
+func (self *AssetMgr) matches(name string) []string {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	var names []string
+	for bname := range self.bundles {
+		if bname == name || strings.TrimSuffix(bname, path.Ext(bname)) == name {
+			names = append(names, bname)
+		}
+	}
+	// the style sheets go first
+	sort.Slice(names, func(i, j int) bool {
+		ci, cj := path.Ext(names[i]) == ".css", path.Ext(names[j]) == ".css"
+		if ci != cj {
+			return ci
+		}
+		return names[i] < names[j]
+	})
+	return names
+}
+
+func assetTag(name, url string) string {
+	url = template.HTMLEscapeString(url)
+	switch strings.ToLower(path.Ext(name)) {
+	case ".css":
+		return `<link rel="stylesheet" href="` + url + `">`
+	case ".js":
+		return `<script src="` + url + `"></script>`
+	}
+	return ""
+}
+
+// AddBundle declares the asset bundle name, e.g. app.css or app.js,
+// concatenating and minifying the static files. See AssetTags.
+func (a *App) AddBundle(name string, files ...string) *Bundle {
+	return a.AssetMgr.Add(name, files...)
+}
+
+// AssetUrl returns the fingerprinted url of the asset bundle name.
+func (a *App) AssetUrl(name string) (string, error) {
+	b, err := a.AssetMgr.get(name)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(a.staticBasePath(), fingerprintName(b.name, b.ver)), nil
+}
+
+// AssetTags is the AssetTags template func, it returns the <link> and
+// <script> tags of the bundles of name, e.g. {{AssetTags "app"}} for
+// app.css and app.js. In Debug mode they link the files of the bundles.
+func (a *App) AssetTags(name string) (template.HTML, error) {
+	names := a.AssetMgr.matches(name)
+	if len(names) == 0 {
+		return "", fmt.Errorf("no asset bundle %v", name)
+	}
+	var tags []string
+	for _, bname := range names {
+		if a.AppConfig.Mode == Debug {
+			a.AssetMgr.mutex.Lock()
+			files := a.AssetMgr.bundles[bname].Files
+			a.AssetMgr.mutex.Unlock()
+			for _, file := range files {
+				tags = append(tags, assetTag(bname, a.StaticUrl(strings.TrimPrefix(file, "/"))))
+			}
+			continue
+		}
+		url, err := a.AssetUrl(bname)
+		if err != nil {
+			return "", err
+		}
+		tags = append(tags, assetTag(bname, url))
+	}
+	return template.HTML(strings.Join(tags, "\n")), nil
+}
+
+// serveAsset serves the asset bundle name, a fs.FS path, under its
+// fingerprinted name or its plain one.
+func (a *App) serveAsset(name string, req *http.Request, w http.ResponseWriter) bool {
+	if !a.AssetMgr.has(name) {
+		orig, ver, ok := parseFingerprint(name)
+		if !ok || !a.AssetMgr.has(orig) {
+			return false
+		}
+		b, err := a.AssetMgr.get(orig)
+		if err != nil || b.ver != ver {
+			return false
+		}
+		// the name changes with the content
+		w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+		w.Header().Set("Expires", webTime(time.Now().UTC().AddDate(1, 0, 0)))
+		name = orig
+	}
+	b, err := a.AssetMgr.get(name)
+	if err != nil {
+		a.Error(err)
+		return false
+	}
+
+	h := w.Header()
+	ctype := mime.TypeByExtension(path.Ext(b.name))
+	if ctype == "" {
+		ctype = "application/octet-stream"
+	}
+	h.Set("Content-Type", ctype)
+	etag := b.ver
+	content := b.content
+	if a.Server.Config.EnableGzip {
+		addVary(h, "Accept-Encoding")
+		if enc := a.acceptEncoding(req, int64(len(content))); enc != "" {
+			a.AssetMgr.mutex.Lock()
+			zipped, ok := b.zipped[enc]
+			a.AssetMgr.mutex.Unlock()
+			if !ok {
+				// compress outside the lock, the best levels are slow; two
+				// requests may both compress it, the result is the same
+				if zipped, err = compressBytes(content, enc, true); err == nil {
+					a.AssetMgr.mutex.Lock()
+					b.zipped[enc] = zipped
+					a.AssetMgr.mutex.Unlock()
+				}
+			}
+			if err == nil {
+				h.Set("Content-Encoding", enc)
+				etag += "-" + enc
+				content = zipped
+			}
+		}
+	}
+	h.Set("Etag", `"`+etag+`"`)
+	http.ServeContent(w, req, b.name, b.modTime, bytes.NewReader(content))
+	return true
+}
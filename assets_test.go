@@ -0,0 +1,75 @@
+package xweb
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMinifyCSS(t *testing.T) {
+	tests := map[string]string{
+		"a {\n  color: red;\n  /* comment */\n  margin: 0 auto;\n}\n": "a{color:red;margin:0 auto}",
+		"div :first-child , p > a { }":                                "div :first-child,p>a{}",
+		"@media screen and (max-width: 100px) { a { b: c } }":         "@media screen and (max-width:100px){a{b:c}}",
+		"a { content: \"/* x */  y\"; width: calc(1px + 2px) }":       "a{content:\"/* x */  y\";width:calc(1px + 2px)}",
+	}
+	for src, want := range tests {
+		if got := string(MinifyCSS([]byte(src))); got != want {
+			t.Errorf("MinifyCSS(%q) = %q, want %q", src, got, want)
+		}
+	}
+}
+
+func TestMinifyJS(t *testing.T) {
+	tests := map[string]string{
+		"/*! license */\nvar a = 1; // one\nvar b = a - -1;\n":  "/*! license */\nvar a=1;var b=a - -1;",
+		"function f(x) {\n\treturn x\n}\nf(2)\n":                "function f(x){return x}\nf(2)",
+		"var s = 'a // b', r = /\\/*[/]x/g;  /* c */ y = 1 / 2": "var s='a // b',r=/\\/*[/]x/g;y=1 / 2",
+		"return\n{}": "return\n{}",
+		"var s = `a ${ f(`b ${c}  d`, {x: '}'}) }  e`;  g()": "var s=`a ${ f(`b ${c}  d`, {x: '}'}) }  e`;g()",
+	}
+	for src, want := range tests {
+		if got := string(MinifyJS([]byte(src))); got != want {
+			t.Errorf("MinifyJS(%q) = %q, want %q", src, got, want)
+		}
+	}
+}
+
+func TestMinifyHTML(t *testing.T) {
+	src := "<div>\n  <!-- hidden -->\n  <p>a   b</p>\n  <!--[if IE]>ie<![endif]-->\n" +
+		"  <pre>x\n  y</pre>\n  {{if .A}}  {{\"a  b\"}}{{end}}\n</div>\n"
+	want := "<div> <p>a b</p> <!--[if IE]>ie<![endif]--> <pre>x\n  y</pre> {{if .A}} {{\"a  b\"}}{{end}} </div>"
+	if got := string(MinifyHTML([]byte(src))); got != want {
+		t.Errorf("MinifyHTML = %q, want %q", got, want)
+	}
+
+	tests := map[string]string{
+		// ToLower changes the length of these letters
+		"<p>İİ \u212a</p>  <PRE>a  b</PRE>\n<Script>x  y</SCRIPT>": "<p>İİ \u212a</p> <PRE>a  b</PRE> <Script>x  y</SCRIPT>",
+		"<input  title=\"a   b\"\n value='c  d' >  x":              "<input title=\"a   b\" value='c  d' > x",
+		"<a title=\"{{T \"a  b\"}}  c\">it's  </a>":                "<a title=\"{{T \"a  b\"}}  c\">it's </a>",
+		"\u212a\u212a<pre>x</pre>":                                 "\u212a\u212a<pre>x</pre>",
+		"<pre":                                                     "<pre",
+		"<p>İ<pre":                                                 "<p>İ<pre",
+	}
+	for src, want := range tests {
+		if got := string(MinifyHTML([]byte(src))); got != want {
+			t.Errorf("MinifyHTML(%q) = %q, want %q", src, got, want)
+		}
+	}
+}
+
+func TestAssetMgrMatches(t *testing.T) {
+	mgr := new(AssetMgr)
+	mgr.Add("app.js", "js/a.js")
+	mgr.Add("/app.css", "css/a.css")
+	mgr.Add("admin.js", "js/admin.js")
+	if got := mgr.matches("app"); !reflect.DeepEqual(got, []string{"app.css", "app.js"}) {
+		t.Errorf("matches(app) = %v", got)
+	}
+	if got := mgr.matches("app.js"); !reflect.DeepEqual(got, []string{"app.js"}) {
+		t.Errorf("matches(app.js) = %v", got)
+	}
+	if !mgr.has("app.css") || mgr.has("app") {
+		t.Error("has should only know the full bundle names")
+	}
+}
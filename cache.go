@@ -0,0 +1,603 @@
+package xweb
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"context"
+	"crypto/sha1"
+	"encoding/gob"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CacheEntry is a response stored by the ResponseCache.
+type CacheEntry struct {
+	Status     int
+	Header     http.Header
+	Body       []byte
+	Tags       []string
+	Created    time.Time
+	Expires    time.Time // fresh until
+	StaleUntil time.Time // served while revalidating until
+}
+
+func (e *CacheEntry) size() int64 {
+	size := int64(len(e.Body))
+	for k, vs := range e.Header {
+		for _, v := range vs {
+			size += int64(len(k) + len(v))
+		}
+	}
+	return size
+}
+
+// CacheStore is the storage backend of a ResponseCache.
+type CacheStore interface {
+	Get(key string) (*CacheEntry, bool)
+	Set(key string, entry *CacheEntry) error
+	Delete(key string) error
+}
+
+// MemoryCacheStore keeps the entries in memory, evicting the least
+// recently used ones once their total size exceeds MaxSize bytes.
+type MemoryCacheStore struct {
+	MaxSize int64
+
+	mutex sync.Mutex
+	size  int64
+	lru   *list.List
+	items map[string]*list.Element
+}
+
+type memoryCacheItem struct {
+	key   string
+	entry *CacheEntry
+	size  int64
+}
+
+func NewMemoryCacheStore(maxSize int64) *MemoryCacheStore {
+	return &MemoryCacheStore{
+		MaxSize: maxSize,
+		lru:     list.New(),
+		items:   make(map[string]*list.Element),
+	}
+}
+
+func (s *MemoryCacheStore) Get(key string) (*CacheEntry, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.lru.MoveToFront(el)
+		return el.Value.(*memoryCacheItem).entry, true
+	}
+	return nil, false
+}
+
+func (s *MemoryCacheStore) Set(key string, entry *CacheEntry) error {
+	size := entry.size() + int64(len(key))
+	if s.MaxSize > 0 && size > s.MaxSize {
+		return s.Delete(key)
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+	s.items[key] = s.lru.PushFront(&memoryCacheItem{key, entry, size})
+	s.size += size
+	for s.MaxSize > 0 && s.size > s.MaxSize {
+		s.remove(s.lru.Back())
+	}
+	return nil
+}
+
+func (s *MemoryCacheStore) Delete(key string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+	return nil
+}
+
+func (s *MemoryCacheStore) remove(el *list.Element) {
+	item := s.lru.Remove(el).(*memoryCacheItem)
+	delete(s.items, item.key)
+	s.size -= item.size
+}
+
+// Size returns the total size of the stored entries.
+func (s *MemoryCacheStore) Size() int64 {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.size
+}
+
+// DiskCacheStore keeps each entry in a file of Dir, so that the cache
+// survives restarts.
+type DiskCacheStore struct {
+	Dir string
+}
+
+func NewDiskCacheStore(dir string) (*DiskCacheStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &DiskCacheStore{Dir: dir}, nil
+}
+
+func (s *DiskCacheStore) path(key string) string {
+	sum := sha1.Sum([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(s.Dir, name[:2], name)
+}
+
+func (s *DiskCacheStore) Get(key string) (*CacheEntry, bool) {
+	content, err := ioutil.ReadFile(s.path(key))
+	if err != nil {
+		return nil, false
+	}
+	var entry CacheEntry
+	if err := gob.NewDecoder(bytes.NewReader(content)).Decode(&entry); err != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (s *DiskCacheStore) Set(key string, entry *CacheEntry) error {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(entry); err != nil {
+		return err
+	}
+	p := s.path(key)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	// write then rename so that readers never see a partial entry
+	f, err := ioutil.TempFile(filepath.Dir(p), ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(buf.Bytes())
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), p)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+func (s *DiskCacheStore) Delete(key string) error {
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// cachePolicy is how the response of an action is cached, from the
+// route options and the Action.Cache* calls.
+type cachePolicy struct {
+	ttl   time.Duration
+	stale time.Duration
+	vary  []string
+	tags  []string
+}
+
+func (c *Action) cachePolicy() *cachePolicy {
+	if c.cache == nil {
+		c.cache = &cachePolicy{}
+	}
+	return c.cache
+}
+
+// CacheFor stores the response in the App's ResponseCache for ttl, the
+// next GET and HEAD requests of the same URL being answered without
+// calling the handler. Once ttl elapsed, the stale response is still
+// served during staleWhileRevalidate while a fresh one is generated in
+// background. It must be called before the response is written.
+func (c *Action) CacheFor(ttl time.Duration, staleWhileRevalidate ...time.Duration) {
+	p := c.cachePolicy()
+	p.ttl = ttl
+	if len(staleWhileRevalidate) > 0 {
+		p.stale = staleWhileRevalidate[0]
+	}
+	c.captureResponse()
+}
+
+// captureResponse records the response of the action from now on, so
+// that it can be stored once the handler returned.
+func (c *Action) captureResponse() {
+	if c.App.ResponseCache == nil || c.cacheWriter != nil ||
+		(c.Request.Method != "GET" && c.Request.Method != "HEAD") {
+		return
+	}
+	c.cacheWriter = &cacheWriter{ResponseWriter: c.ResponseWriter, action: c}
+	c.ResponseWriter = c.cacheWriter
+}
+
+// CacheVary keeps a cached response per value of the given request
+// headers. "session" varies on the session of the user and "lang" on
+// the language of the request. The headers listed by the Vary header
+// of the response and the language, once the action used it, are
+// added to them.
+func (c *Action) CacheVary(keys ...string) {
+	p := c.cachePolicy()
+	p.vary = append(p.vary, keys...)
+}
+
+// CacheTags tags the cached response so that ResponseCache.Invalidate
+// removes it, e.g. c.CacheTags("article:42").
+func (c *Action) CacheTags(tags ...string) {
+	p := c.cachePolicy()
+	p.tags = append(p.tags, tags...)
+}
+
+type cacheRevalidateKey struct{}
+
+// ResponseCache stores the responses of the actions calling CacheFor or
+// of the routes having a cache option, e.g.
+// `xweb:"GET /articles cache=5m stale=1m vary=Accept-Language"`.
+// Requests sent with Cache-Control: no-cache bypass it. It's disabled
+// until App.ResponseCache is set, e.g.
+//
+//	app.ResponseCache = xweb.NewResponseCache(xweb.NewMemoryCacheStore(32 << 20))
+type ResponseCache struct {
+	Store CacheStore
+	// RevalidateTimeout cancels the context of the background
+	// revalidations running longer, their response is then dropped.
+	RevalidateTimeout time.Duration
+
+	mutex        sync.Mutex
+	maxAge       time.Duration // longest ttl+stale of the entries seen
+	invalidated  map[string]time.Time
+	revalidating map[string]bool
+	routes       map[string]bool // the routes whose responses were stored
+}
+
+func NewResponseCache(store CacheStore) *ResponseCache {
+	return &ResponseCache{
+		Store:             store,
+		RevalidateTimeout: 30 * time.Second,
+		invalidated:       make(map[string]time.Time),
+		revalidating:      make(map[string]bool),
+		routes:            make(map[string]bool),
+	}
+}
+
+// Invalidate expires every response cached with one of tags.
+func (rc *ResponseCache) Invalidate(tags ...string) {
+	now := time.Now()
+	rc.mutex.Lock()
+	for _, tag := range tags {
+		rc.invalidated[tag] = now
+	}
+	rc.prune(now)
+	rc.mutex.Unlock()
+}
+
+// prune forgets the invalidations older than the lifetime of the
+// entries, which are gone by then.
+func (rc *ResponseCache) prune(now time.Time) {
+	if rc.maxAge <= 0 {
+		return
+	}
+	for tag, t := range rc.invalidated {
+		if now.Sub(t) > rc.maxAge {
+			delete(rc.invalidated, tag)
+		}
+	}
+}
+
+func (rc *ResponseCache) seen(entry *CacheEntry) {
+	if age := entry.StaleUntil.Sub(entry.Created); age > rc.maxAge {
+		rc.maxAge = age
+	}
+}
+
+func (rc *ResponseCache) get(key string) (*CacheEntry, bool) {
+	entry, ok := rc.Store.Get(key)
+	if !ok {
+		return nil, false
+	}
+	now := time.Now()
+	valid := now.Before(entry.StaleUntil)
+	rc.mutex.Lock()
+	rc.seen(entry)
+	for _, tag := range entry.Tags {
+		if t, ok := rc.invalidated[tag]; ok && !entry.Created.After(t) {
+			valid = false
+		}
+	}
+	rc.mutex.Unlock()
+	if !valid {
+		rc.Store.Delete(key)
+		return nil, false
+	}
+	return entry, true
+}
+
+func cachePrimaryKey(req *http.Request) string {
+	return req.Host + req.URL.Path + "?" + req.URL.Query().Encode()
+}
+
+func (c *Action) cacheKey(primary string, vary []string) string {
+	key := primary
+	for _, name := range vary {
+		var value string
+		if strings.EqualFold(name, "session") {
+			if c.hasSession() {
+				value = string(c.Session().Id())
+			}
+		} else if strings.EqualFold(name, "lang") {
+			value = c.Lang()
+		} else {
+			value = c.Header(name)
+		}
+		key += "\n" + name + ":" + value
+	}
+	return key
+}
+
+func noCacheRequested(req *http.Request) bool {
+	return strings.Contains(strings.ToLower(req.Header.Get("Cache-Control")), "no-cache") ||
+		strings.Contains(strings.ToLower(req.Header.Get("Pragma")), "no-cache")
+}
+
+func cacheRouteId(route *Route) string {
+	return route.HandlerElement.String() + "." + route.HandlerMethod
+}
+
+// cached reports whether responses of route may be in the cache, only
+// those of the routes having a cache option or once stored are looked
+// up.
+func (rc *ResponseCache) cached(route *Route) bool {
+	if route.Options.CacheTTL > 0 {
+		return true
+	}
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+	return rc.routes[cacheRouteId(route)]
+}
+
+// serve answers the request from the cache. It returns false when
+// there is no usable entry.
+func (rc *ResponseCache) serve(c *Action, route *Route, args []reflect.Value) bool {
+	req := c.Request
+	if req.Context().Value(cacheRevalidateKey{}) != nil || noCacheRequested(req) {
+		return false
+	}
+	primary := cachePrimaryKey(req)
+	meta, ok := rc.get("vary:" + primary)
+	if !ok {
+		return false
+	}
+	var vary []string
+	if len(meta.Body) > 0 {
+		vary = strings.Split(string(meta.Body), "\n")
+	}
+	key := c.cacheKey(primary, vary)
+	entry, ok := rc.get(key)
+	if !ok {
+		return false
+	}
+	now := time.Now()
+	if now.After(entry.Expires) {
+		rc.revalidate(c.App, req, key, route, args)
+	}
+
+	h := c.ResponseWriter.Header()
+	for k, v := range entry.Header {
+		h[k] = append([]string(nil), v...)
+	}
+	h.Set("Age", strconv.FormatInt(int64(now.Sub(entry.Created)/time.Second), 10))
+	var modtime time.Time
+	if lm := entry.Header.Get("Last-Modified"); lm != "" {
+		modtime, _ = http.ParseTime(lm)
+	}
+	if c.CheckPreconditions(entry.Header.Get("ETag"), modtime) {
+		return true
+	}
+	if c.Header("Range") != "" && entry.Header.Get("Content-Encoding") == "" {
+		c.serveRange(entry.Body)
+		return true
+	}
+	c.StatusCode = entry.Status
+	c.ResponseWriter.WriteHeader(entry.Status)
+	c.ResponseWriter.Write(entry.Body)
+	return true
+}
+
+// revalidate generates a fresh response for the stale entry key in
+// background, once at a time. The handler is run directly, without the
+// filters and the request logging, and with a GET request whose
+// context is canceled after RevalidateTimeout.
+func (rc *ResponseCache) revalidate(app *App, req *http.Request, key string, route *Route, args []reflect.Value) {
+	rc.mutex.Lock()
+	if rc.revalidating[key] {
+		rc.mutex.Unlock()
+		return
+	}
+	rc.revalidating[key] = true
+	rc.mutex.Unlock()
+
+	ctx := context.WithValue(context.Background(), cacheRevalidateKey{}, true)
+	cancel := context.CancelFunc(func() {})
+	if rc.RevalidateTimeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, rc.RevalidateTimeout)
+	}
+	r := req.Clone(ctx)
+	r.Method = "GET"
+	r.Body = http.NoBody
+	r.ContentLength = 0
+	r.Form, r.PostForm, r.MultipartForm = r.URL.Query(), url.Values{}, nil
+	w := &discardWriter{header: make(http.Header)}
+	w.header.Set("Content-Type", "text/html; charset=utf-8")
+	go func() {
+		defer func() {
+			cancel()
+			rc.mutex.Lock()
+			delete(rc.revalidating, key)
+			rc.mutex.Unlock()
+		}()
+		app.run(r, w, *route, args)
+	}()
+}
+
+// store saves the response captured by w if the action asked for it.
+func (rc *ResponseCache) store(c *Action, w *cacheWriter, route *Route) {
+	p := c.cache
+	if p == nil || p.ttl <= 0 || !w.capture || w.streamed || w.status != http.StatusOK {
+		return
+	}
+	if c.Request.Context().Err() != nil {
+		// a revalidation which timed out
+		return
+	}
+	cc := strings.ToLower(w.Header().Get("Cache-Control"))
+	if strings.Contains(cc, "no-store") || strings.Contains(cc, "private") {
+		return
+	}
+
+	header := w.Header().Clone()
+	for _, name := range []string{"Set-Cookie", "Date", "Age"} {
+		header.Del(name)
+	}
+	vary := append([]string(nil), p.vary...)
+	for _, v := range header["Vary"] {
+		for _, name := range strings.Split(v, ",") {
+			name = strings.TrimSpace(name)
+			if name == "*" {
+				return
+			}
+			if name != "" {
+				vary = appendVary(vary, name)
+			}
+		}
+	}
+	if header.Get("Content-Encoding") != "" {
+		vary = appendVary(vary, "Accept-Encoding")
+	}
+	if c.lang != "" {
+		vary = appendVary(vary, "lang")
+	}
+
+	now := time.Now()
+	entry := &CacheEntry{
+		Status:     w.status,
+		Header:     header,
+		Body:       w.buf.Bytes(),
+		Tags:       p.tags,
+		Created:    now,
+		Expires:    now.Add(p.ttl),
+		StaleUntil: now.Add(p.ttl + p.stale),
+	}
+	primary := cachePrimaryKey(c.Request)
+	meta := &CacheEntry{
+		Body:       []byte(strings.Join(vary, "\n")),
+		Created:    now,
+		Expires:    entry.StaleUntil,
+		StaleUntil: entry.StaleUntil,
+	}
+	if err := rc.Store.Set("vary:"+primary, meta); err != nil {
+		c.App.Warn("response cache:", err)
+		return
+	}
+	if err := rc.Store.Set(c.cacheKey(primary, vary), entry); err != nil {
+		c.App.Warn("response cache:", err)
+		return
+	}
+	rc.mutex.Lock()
+	rc.seen(entry)
+	rc.routes[cacheRouteId(route)] = true
+	rc.mutex.Unlock()
+}
+
+func appendVary(vary []string, name string) []string {
+	for _, v := range vary {
+		if strings.EqualFold(v, name) {
+			return vary
+		}
+	}
+	return append(vary, name)
+}
+
+// cacheWriter records the response of an action which may be cached.
+// The body is only kept once the action asked for caching.
+type cacheWriter struct {
+	http.ResponseWriter
+	action   *Action
+	status   int
+	buf      bytes.Buffer
+	started  bool
+	capture  bool
+	streamed bool
+}
+
+func (w *cacheWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.capture = w.action.cache != nil && w.action.cache.ttl > 0
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+	}
+	if w.capture {
+		w.buf.Write(p)
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+// Flush marks the response as streamed, it is never cached.
+func (w *cacheWriter) Flush() {
+	w.streamed = true
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+func (w *cacheWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.streamed = true
+	if h, ok := w.ResponseWriter.(http.Hijacker); ok {
+		return h.Hijack()
+	}
+	return nil, nil, errors.New("the ResponseWriter does not support hijacking")
+}
+
+// discardWriter is the ResponseWriter of background revalidations.
+type discardWriter struct {
+	header http.Header
+}
+
+func (w *discardWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *discardWriter) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func (w *discardWriter) WriteHeader(int) {}
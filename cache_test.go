@@ -0,0 +1,296 @@
+package xweb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-xweb/log"
+)
+
+func TestMemoryCacheStoreEviction(t *testing.T) {
+	s := NewMemoryCacheStore(25)
+	s.Set("a", &CacheEntry{Body: make([]byte, 10)})
+	s.Set("b", &CacheEntry{Body: make([]byte, 10)})
+	s.Get("a")
+	s.Set("c", &CacheEntry{Body: make([]byte, 10)})
+	if _, ok := s.Get("b"); ok {
+		t.Error("the least recently used entry should be evicted")
+	}
+	if _, ok := s.Get("a"); !ok {
+		t.Error("a recently used entry was evicted")
+	}
+	if s.Size() > 25 {
+		t.Errorf("size %d exceeds the limit", s.Size())
+	}
+	s.Set("d", &CacheEntry{Body: make([]byte, 30)})
+	if _, ok := s.Get("d"); ok {
+		t.Error("an entry larger than the store should not be kept")
+	}
+}
+
+func TestDiskCacheStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xwebcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s, err := NewDiskCacheStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := &CacheEntry{Status: 200, Body: []byte("hello"), Tags: []string{"t"}, Expires: time.Now()}
+	if err := s.Set("/index?", entry); err != nil {
+		t.Fatal(err)
+	}
+	got, ok := s.Get("/index?")
+	if !ok || string(got.Body) != "hello" || got.Tags[0] != "t" {
+		t.Fatalf("unexpected entry %v", got)
+	}
+	s.Delete("/index?")
+	if _, ok := s.Get("/index?"); ok {
+		t.Error("deleted entry still found")
+	}
+}
+
+var cacheCalls = struct {
+	sync.Mutex
+	n map[string]int
+}{n: map[string]int{}}
+
+// cacheCall counts the calls of the handler name.
+func cacheCall(name string) string {
+	cacheCalls.Lock()
+	defer cacheCalls.Unlock()
+	cacheCalls.n[name]++
+	return fmt.Sprintf("%s %d", name, cacheCalls.n[name])
+}
+
+type cacheAction struct {
+	*Action
+	article  Mapper `xweb:"GET /article cache=1m"`
+	theme    Mapper `xweb:"GET /theme cache=1m vary=X-Theme"`
+	device   Mapper `xweb:"GET /device cache=1m"`
+	greet    Mapper `xweb:"GET /greet cache=1m"`
+	login    Mapper `xweb:"GET /login"`
+	user     Mapper `xweb:"GET /user cache=1m vary=session"`
+	tagged   Mapper `xweb:"GET /tagged"`
+	stale    Mapper `xweb:"GET /stale"`
+	noStore  Mapper `xweb:"GET /nostore cache=1m"`
+	private  Mapper `xweb:"GET /private cache=1m"`
+	missing  Mapper `xweb:"GET /missing cache=1m"`
+	uncached Mapper `xweb:"GET /uncached"`
+}
+
+func (c *cacheAction) Article() string {
+	return cacheCall("article")
+}
+
+func (c *cacheAction) Theme() string {
+	return cacheCall("theme") + " " + c.Header("X-Theme")
+}
+
+func (c *cacheAction) Device() string {
+	c.SetHeader("Vary", "X-Device")
+	return cacheCall("device") + " " + c.Header("X-Device")
+}
+
+func (c *cacheAction) Greet() string {
+	return cacheCall("greet") + " " + c.Tr("hello")
+}
+
+func (c *cacheAction) Login() string {
+	c.SetSession("user", c.GetString("name"))
+	return "ok"
+}
+
+func (c *cacheAction) User() string {
+	var name string
+	if c.hasSession() {
+		name, _ = c.GetSession("user").(string)
+	}
+	return cacheCall("user") + " " + name
+}
+
+func (c *cacheAction) Tagged() string {
+	c.CacheFor(time.Minute)
+	c.CacheTags("article:1")
+	return cacheCall("tagged")
+}
+
+func (c *cacheAction) Stale() string {
+	c.CacheFor(20*time.Millisecond, time.Minute)
+	return cacheCall("stale")
+}
+
+func (c *cacheAction) NoStore() string {
+	c.SetHeader("Cache-Control", "no-store")
+	return cacheCall("nostore")
+}
+
+func (c *cacheAction) Private() string {
+	c.SetHeader("Cache-Control", "private, max-age=60")
+	return cacheCall("private")
+}
+
+func (c *cacheAction) Missing() error {
+	cacheCall("missing")
+	return NotFound()
+}
+
+func (c *cacheAction) Uncached() string {
+	return cacheCall("uncached")
+}
+
+func newCacheServer(cache bool) *Server {
+	s := NewServer("cache")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.AddAction(&cacheAction{})
+	s.RootApp.AppConfig.SessionOn = true
+	if cache {
+		s.RootApp.ResponseCache = NewResponseCache(NewMemoryCacheStore(1 << 20))
+	}
+	s.RootApp.I18n.Add("en", map[string]interface{}{"hello": "hello"})
+	s.RootApp.I18n.Add("fr", map[string]interface{}{"hello": "bonjour"})
+	s.initServer()
+	return s
+}
+
+func cacheGet(s *Server, path string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Add(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	return w
+}
+
+func TestResponseCache(t *testing.T) {
+	cacheCalls.Lock()
+	cacheCalls.n = map[string]int{}
+	cacheCalls.Unlock()
+	s := newCacheServer(true)
+	rc := s.RootApp.ResponseCache
+
+	expect := func(w *httptest.ResponseRecorder, status int, body string) {
+		t.Helper()
+		if w.Code != status || w.Body.String() != body {
+			t.Errorf("got %d %q, want %d %q", w.Code, w.Body.String(), status, body)
+		}
+	}
+
+	expect(cacheGet(s, "/article"), 200, "article 1")
+	w := cacheGet(s, "/article")
+	expect(w, 200, "article 1")
+	if w.Header().Get("Age") == "" {
+		t.Error("a cached response should have an Age header")
+	}
+	expect(cacheGet(s, "/article?page=2"), 200, "article 2")
+	// no-cache bypasses the cache and refreshes it
+	expect(cacheGet(s, "/article", "Cache-Control", "no-cache"), 200, "article 3")
+	expect(cacheGet(s, "/article"), 200, "article 3")
+
+	// vary= option and the Vary header of the response
+	expect(cacheGet(s, "/theme", "X-Theme", "dark"), 200, "theme 1 dark")
+	expect(cacheGet(s, "/theme", "X-Theme", "light"), 200, "theme 2 light")
+	expect(cacheGet(s, "/theme", "X-Theme", "dark"), 200, "theme 1 dark")
+	expect(cacheGet(s, "/device", "X-Device", "phone"), 200, "device 1 phone")
+	expect(cacheGet(s, "/device", "X-Device", "tablet"), 200, "device 2 tablet")
+	expect(cacheGet(s, "/device", "X-Device", "phone"), 200, "device 1 phone")
+
+	// the language used by the action
+	expect(cacheGet(s, "/greet", "Accept-Language", "fr"), 200, "greet 1 bonjour")
+	expect(cacheGet(s, "/greet", "Accept-Language", "en"), 200, "greet 2 hello")
+	expect(cacheGet(s, "/greet", "Accept-Language", "fr-CA,fr"), 200, "greet 1 bonjour")
+
+	// vary=session, without creating sessions for the anonymous users
+	login := func(name string) string {
+		cookies := cacheGet(s, "/login?name="+name).Result().Cookies()
+		if len(cookies) == 0 {
+			t.Fatal("no session cookie")
+		}
+		return cookies[0].String()
+	}
+	alice, bob := login("alice"), login("bob")
+	expect(cacheGet(s, "/user", "Cookie", alice), 200, "user 1 alice")
+	expect(cacheGet(s, "/user", "Cookie", bob), 200, "user 2 bob")
+	expect(cacheGet(s, "/user", "Cookie", alice), 200, "user 1 alice")
+	w = cacheGet(s, "/user")
+	expect(w, 200, "user 3 ")
+	if c := w.Header().Get("Set-Cookie"); c != "" {
+		t.Errorf("a session was created for an anonymous user: %s", c)
+	}
+	expect(cacheGet(s, "/user"), 200, "user 3 ")
+
+	// CacheFor and Invalidate
+	expect(cacheGet(s, "/tagged"), 200, "tagged 1")
+	expect(cacheGet(s, "/tagged"), 200, "tagged 1")
+	rc.Invalidate("article:1")
+	expect(cacheGet(s, "/tagged"), 200, "tagged 2")
+	expect(cacheGet(s, "/tagged"), 200, "tagged 2")
+
+	// not stored
+	for _, path := range []string{"/nostore", "/private", "/uncached"} {
+		expect(cacheGet(s, path), 200, path[1:]+" 1")
+		expect(cacheGet(s, path), 200, path[1:]+" 2")
+	}
+	cacheGet(s, "/missing")
+	if w := cacheGet(s, "/missing"); w.Code != 404 {
+		t.Errorf("got %d, want 404", w.Code)
+	}
+	cacheCalls.Lock()
+	if n := cacheCalls.n["missing"]; n != 2 {
+		t.Errorf("a 404 was cached, %d calls", n)
+	}
+	cacheCalls.Unlock()
+	if route := s.RootApp.RoutesEq["/uncached"]["GET"]; rc.cached(&route) {
+		t.Error("the responses of a route never cached are looked up")
+	}
+
+	// stale while revalidate
+	expect(cacheGet(s, "/stale"), 200, "stale 1")
+	time.Sleep(30 * time.Millisecond)
+	expect(cacheGet(s, "/stale"), 200, "stale 1")
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		if w := cacheGet(s, "/stale"); w.Body.String() == "stale 2" {
+			break
+		} else if w.Body.String() != "stale 1" || time.Now().After(deadline) {
+			t.Fatalf("got %q while revalidating", w.Body.String())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestResponseCacheDisabled(t *testing.T) {
+	s := newCacheServer(false)
+	if s.RootApp.ResponseCache != nil {
+		t.Fatal("the response cache should be opt-in")
+	}
+	first := cacheGet(s, "/article").Body.String()
+	if second := cacheGet(s, "/article").Body.String(); first == second {
+		t.Errorf("a response was cached without ResponseCache: %q", second)
+	}
+}
+
+func TestResponseCachePrune(t *testing.T) {
+	rc := NewResponseCache(NewMemoryCacheStore(0))
+	rc.Invalidate("kept")
+	if len(rc.invalidated) != 1 {
+		t.Fatal("an invalidation was pruned before any entry was seen")
+	}
+	rc.maxAge = time.Minute
+	rc.invalidated["old"] = time.Now().Add(-2 * time.Minute)
+	rc.Invalidate("new")
+	if _, ok := rc.invalidated["old"]; ok {
+		t.Error("an invalidation older than the entries was kept")
+	}
+	if len(rc.invalidated) != 2 {
+		t.Errorf("unexpected invalidations %v", rc.invalidated)
+	}
+}
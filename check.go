@@ -0,0 +1,216 @@
+package xweb
+
+import (
+	"fmt"
+	"html/template"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template/parse"
+)
+
+// TemplateError is a problem of a template file found by
+// App.CheckTemplates.
+type TemplateError struct {
+	File string
+	Line int // 0 when unknown
+	Msg  string
+}
+
+func (e *TemplateError) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("%v:%v: %v", e.File, e.Line, e.Msg)
+	}
+	return e.File + ": " + e.Msg
+}
+
+// TemplateErrors are all the problems found by App.CheckTemplates.
+type TemplateErrors []*TemplateError
+
+func (errs TemplateErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, err := range errs {
+		msgs[i] = err.Error()
+	}
+	return strings.Join(msgs, "\n")
+}
+
+var templateErrorRegexp = regexp.MustCompile(`^template: (.+?):(\d+):(?:\d+:)? (.*)$`)
+
+// newTemplateError turns a parse error of the template file into a
+// TemplateError.
+func newTemplateError(file string, err error) *TemplateError {
+	if m := templateErrorRegexp.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[2])
+		return &TemplateError{m[1], line, m[3]}
+	}
+	return &TemplateError{file, 0, err.Error()}
+}
+
+// CheckTemplates parses all the files of the template dir with the funcs
+// of the App, so that the typos show before a page is rendered, e.g. in
+// a test or a CI step. It reports the parse errors, the undefined funcs
+// and the included or layout templates which don't exist. The names of
+// the funcs the handlers add with AddTmplVar are given as requestFuncNames.
+// The error is a TemplateErrors.
+func (a *App) CheckTemplates(requestFuncNames ...string) error {
+	a.initFuncs()
+	funcs := copyFuncMap(a.FuncMaps)
+	bound := (&Action{App: a}).requestFuncs()
+	for _, name := range requestFuncNames {
+		bound[name] = nil
+	}
+	for name := range bound {
+		if _, ok := funcs[name]; !ok {
+			funcs[name] = unboundFunc(name)
+		}
+	}
+
+	fsys := a.templateFS()
+	var files []string
+	err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && name != "." {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() {
+			files = append(files, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return TemplateErrors{{".", 0, err.Error()}}
+	}
+	sort.Strings(files)
+
+	var errs TemplateErrors
+	for _, file := range files {
+		content, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			errs = append(errs, &TemplateError{file, 0, err.Error()})
+			continue
+		}
+		engine := a.templateEngine(file)
+		switch engine.(type) {
+		case HtmlTemplateEngine, TextTemplateEngine:
+			if fileErrs := checkTemplateFile(fsys, file, string(content), funcs); len(fileErrs) > 0 {
+				errs = append(errs, fileErrs...)
+				continue
+			}
+		}
+		if _, err = engine.Parse([]TemplateSource{{file, string(content)}}, funcs); err != nil {
+			errs = append(errs, newTemplateError(file, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// builtinFuncs are the funcs predefined by text/template.
+var builtinFuncs = map[string]bool{
+	"and": true, "call": true, "html": true, "index": true, "slice": true,
+	"js": true, "len": true, "not": true, "or": true, "print": true,
+	"printf": true, "println": true, "urlquery": true,
+	"eq": true, "ge": true, "gt": true, "le": true, "lt": true, "ne": true,
+}
+
+// checkTemplateFile parses a Go template file, reporting its syntax
+// error, or else all its undefined funcs and its {{include}} and
+// {{layout}} of templates missing from fsys.
+func checkTemplateFile(fsys fs.FS, file, content string, funcs template.FuncMap) []*TemplateError {
+	tree := parse.New(file)
+	tree.Mode = parse.SkipFuncCheck
+	trees := make(map[string]*parse.Tree)
+	if _, err := tree.Parse(content, "", "", trees); err != nil {
+		return []*TemplateError{newTemplateError(file, err)}
+	}
+
+	var errs []*TemplateError
+	report := func(t *parse.Tree, node parse.Node, msg string) {
+		location, _ := t.ErrorContext(node)
+		line := 0
+		if parts := strings.Split(location, ":"); len(parts) >= 2 {
+			line, _ = strconv.Atoi(parts[len(parts)-2])
+		}
+		errs = append(errs, &TemplateError{file, line, msg})
+	}
+	var walk func(t *parse.Tree, node parse.Node)
+	walk = func(t *parse.Tree, node parse.Node) {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return
+			}
+			for _, child := range n.Nodes {
+				walk(t, child)
+			}
+		case *parse.ActionNode:
+			walk(t, n.Pipe)
+		case *parse.IfNode:
+			walk(t, &n.BranchNode)
+		case *parse.RangeNode:
+			walk(t, &n.BranchNode)
+		case *parse.WithNode:
+			walk(t, &n.BranchNode)
+		case *parse.BranchNode:
+			walk(t, n.Pipe)
+			walk(t, n.List)
+			walk(t, n.ElseList)
+		case *parse.TemplateNode:
+			walk(t, n.Pipe)
+		case *parse.PipeNode:
+			if n == nil {
+				return
+			}
+			for _, cmd := range n.Cmds {
+				walk(t, cmd)
+			}
+		case *parse.ChainNode:
+			walk(t, n.Node)
+		case *parse.IdentifierNode:
+			if _, ok := funcs[n.Ident]; !ok && !builtinFuncs[n.Ident] {
+				report(t, n, fmt.Sprintf("function %q not defined", n.Ident))
+			}
+		case *parse.CommandNode:
+			for _, arg := range n.Args {
+				walk(t, arg)
+			}
+			if len(n.Args) < 2 {
+				return
+			}
+			ident, ok := n.Args[0].(*parse.IdentifierNode)
+			if !ok || ident.Ident != "include" && ident.Ident != "layout" {
+				return
+			}
+			name, ok := n.Args[1].(*parse.StringNode)
+			if !ok {
+				return
+			}
+			if _, err := fs.Stat(fsys, fsName(name.Text)); err != nil {
+				report(t, n, fmt.Sprintf("%v template %q not found", ident.Ident, path.Clean(name.Text)))
+			}
+		}
+	}
+	names := make([]string, 0, len(trees))
+	for name := range trees {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		walk(trees[name], trees[name].Root)
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Line < errs[j].Line
+	})
+	return errs
+}
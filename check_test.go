@@ -0,0 +1,53 @@
+package xweb
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestCheckTemplates(t *testing.T) {
+	app := NewApp("/", "check")
+	app.AppConfig.TemplateFS = fstest.MapFS{
+		"ok.html":      {Data: []byte(`{{layout "base.html"}}{{include "part.html"}} {{StaticUrl "a.js"}} {{who}}`)},
+		"base.html":    {Data: []byte(`<main>{{yield}}</main>`)},
+		"part.html":    {Data: []byte(`{{if .}}{{len .}}{{end}}`)},
+		"syntax.html":  {Data: []byte("line1\n{{if .}}")},
+		"unknown.html": {Data: []byte("{{Nope 1}}\n{{with .}}{{Nada}}{{end}}")},
+		"missing.txt":  {Data: []byte("a\nb {{include \"gone.txt\"}}")},
+	}
+	err := app.CheckTemplates("who")
+	errs, ok := err.(TemplateErrors)
+	if !ok {
+		t.Fatalf("unexpected error %v", err)
+	}
+	want := []string{
+		`missing.txt:2: include template "gone.txt" not found`,
+		`syntax.html:2: unexpected EOF`,
+		`unknown.html:1: function "Nope" not defined`,
+		`unknown.html:2: function "Nada" not defined`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %v", err)
+	}
+	for i, e := range errs {
+		if e.Error() != want[i] {
+			t.Errorf("got %q, want %q", e.Error(), want[i])
+		}
+	}
+}
+
+func TestCheckTemplatesRequestFuncs(t *testing.T) {
+	app := NewApp("/", "checkfuncs")
+	app.AppConfig.SessionOn = true
+	var calls []string
+	for name := range (&Action{App: app}).requestFuncs() {
+		calls = append(calls, "{{if false}}{{"+name+"}}{{end}}")
+	}
+	app.AppConfig.TemplateFS = fstest.MapFS{
+		"all.html": {Data: []byte(strings.Join(calls, ""))},
+	}
+	if err := app.CheckTemplates(); err != nil {
+		t.Errorf("the funcs of the requests are unknown: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+// Command xweb is the command line tool of the xweb framework.
+//
+//	xweb check [-dir templates] [-funcs name,...]
+//
+// check parses all the templates of dir with the xweb funcs and reports
+// their parse errors, undefined funcs and missing included or layout
+// templates. It exits with status 1 when there are any, for CI. The
+// funcs the application adds to its App or actions are passed by name
+// with -funcs.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/go-xweb/xweb"
+)
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: xweb check [-dir templates] [-funcs name,...]")
+	os.Exit(2)
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+	}
+	switch os.Args[1] {
+	case "check":
+		os.Exit(check(os.Args[2:]))
+	default:
+		usage()
+	}
+}
+
+func check(args []string) int {
+	flags := flag.NewFlagSet("check", flag.ExitOnError)
+	dir := flags.String("dir", "templates", "the template dir")
+	funcs := flags.String("funcs", "", "the comma separated names of the funcs added by the application")
+	flags.Parse(args)
+
+	app := xweb.NewApp("/", "check")
+	app.AppConfig.TemplateDir = *dir
+	var names []string
+	if *funcs != "" {
+		names = strings.Split(*funcs, ",")
+	}
+
+	err := app.CheckTemplates(names...)
+	if err == nil {
+		return 0
+	}
+	if errs, ok := err.(xweb.TemplateErrors); ok {
+		for _, e := range errs {
+			fmt.Fprintln(os.Stderr, e)
+		}
+	} else {
+		fmt.Fprintln(os.Stderr, err)
+	}
+	return 1
+}
@@ -0,0 +1,233 @@
+package xweb
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
+)
+
+// defaultCompressEncodings are the supported content codings in order
+// of preference when the client accepts several of them equally.
+var defaultCompressEncodings = []string{"br", "zstd", "gzip", "deflate"}
+
+// defaultCompressMimeTypes are the dynamic responses compressed when
+// ServerConfig.CompressMimeTypes is empty. Images, archives and videos
+// are already compressed.
+var defaultCompressMimeTypes = []string{
+	"text/*",
+	"application/json",
+	"application/javascript",
+	"application/x-javascript",
+	"application/xml",
+	"application/xhtml+xml",
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/x-ndjson",
+	"application/msgpack",
+	"application/x-msgpack",
+	"image/svg+xml",
+}
+
+// negotiateEncoding returns the content coding of offers preferred by
+// an Accept-Encoding header, or an empty string for identity.
+func negotiateEncoding(header string, offers []string) string {
+	if strings.TrimSpace(header) == "" {
+		return ""
+	}
+	return negotiate(header, offers)
+}
+
+// acceptedEncodings returns the offers accepted by an Accept-Encoding
+// header, the ones preferred by the client first.
+func acceptedEncodings(header string, offers []string) []string {
+	if strings.TrimSpace(header) == "" {
+		return nil
+	}
+	ranges := parseAccept(header)
+	var accepted []string
+	quality := make(map[string]float64)
+	for _, offer := range offers {
+		if q := acceptQuality(ranges, offer); q > 0 {
+			accepted = append(accepted, offer)
+			quality[offer] = q
+		}
+	}
+	sort.SliceStable(accepted, func(i, j int) bool {
+		return quality[accepted[i]] > quality[accepted[j]]
+	})
+	return accepted
+}
+
+// compressMimeAllowed reports whether the media type of contentType
+// matches one of the patterns, "text/*" matching any text type.
+func compressMimeAllowed(contentType string, patterns []string) bool {
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	if mediaType == "" {
+		return false
+	}
+	if len(patterns) == 0 {
+		patterns = defaultCompressMimeTypes
+	}
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		if pattern == mediaType ||
+			strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, pattern[:len(pattern)-1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// zstdWindowSize bounds the memory of the zstd encoders, the responses
+// are rarely larger.
+const zstdWindowSize = 1 << 20
+
+// the brotli and zstd encoders are costly to allocate, so they are
+// reused, by level: fast then best.
+var (
+	brotliPools [2]sync.Pool
+	zstdPools   [2]sync.Pool
+)
+
+// pooledWriter puts its encoder back in the pool once closed.
+type pooledWriter struct {
+	io.WriteCloser
+	pool *sync.Pool
+}
+
+func (w *pooledWriter) Close() error {
+	err := w.WriteCloser.Close()
+	if w.pool != nil {
+		w.pool.Put(w.WriteCloser)
+		w.pool = nil
+	}
+	return err
+}
+
+func poolLevel(best bool) int {
+	if best {
+		return 1
+	}
+	return 0
+}
+
+// newCompressWriter returns a writer compressing to w with encoding.
+// best favours the ratio over the speed, for content compressed once.
+func newCompressWriter(w io.Writer, encoding string, best bool) (io.WriteCloser, error) {
+	switch encoding {
+	case "br":
+		pool := &brotliPools[poolLevel(best)]
+		bw, ok := pool.Get().(*brotli.Writer)
+		if ok {
+			bw.Reset(w)
+		} else if best {
+			bw = brotli.NewWriterLevel(w, brotli.BestCompression)
+		} else {
+			bw = brotli.NewWriterLevel(w, 4)
+		}
+		return &pooledWriter{bw, pool}, nil
+	case "zstd":
+		pool := &zstdPools[poolLevel(best)]
+		zw, ok := pool.Get().(*zstd.Encoder)
+		if ok {
+			zw.Reset(w)
+		} else {
+			level := zstd.SpeedFastest
+			if best {
+				level = zstd.SpeedBestCompression
+			}
+			var err error
+			// one goroutine per response, not one per CPU
+			zw, err = zstd.NewWriter(w, zstd.WithEncoderLevel(level),
+				zstd.WithEncoderConcurrency(1), zstd.WithWindowSize(zstdWindowSize))
+			if err != nil {
+				return nil, err
+			}
+		}
+		return &pooledWriter{zw, pool}, nil
+	case "gzip":
+		if best {
+			return gzip.NewWriterLevel(w, gzip.BestCompression)
+		}
+		return gzip.NewWriterLevel(w, gzip.BestSpeed)
+	case "deflate":
+		if best {
+			return flate.NewWriter(w, flate.BestCompression)
+		}
+		return flate.NewWriter(w, flate.BestSpeed)
+	}
+	return nil, fmt.Errorf("unsupported content encoding %q", encoding)
+}
+
+// compressBytes returns content compressed with encoding.
+func compressBytes(content []byte, encoding string, best bool) ([]byte, error) {
+	var buf bytes.Buffer
+	zw, err := newCompressWriter(&buf, encoding, best)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = zw.Write(content); err != nil {
+		zw.Close()
+		return nil, err
+	}
+	if err = zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// addVary adds name to the Vary header unless it's already there.
+func addVary(h http.Header, name string) {
+	for _, v := range h["Vary"] {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
+
+// compressEncodings returns the content codings offered by the server.
+func (s *Server) compressEncodings() []string {
+	if len(s.Config.CompressEncodings) > 0 {
+		return s.Config.CompressEncodings
+	}
+	return defaultCompressEncodings
+}
+
+// acceptEncoding returns the content coding to compress a response of
+// size bytes with, or an empty string when it must be sent as is.
+func (a *App) acceptEncoding(req *http.Request, size int64) string {
+	if !a.Server.Config.EnableGzip || size < int64(a.Server.Config.CompressMinSize) {
+		return ""
+	}
+	return negotiateEncoding(req.Header.Get("Accept-Encoding"), a.Server.compressEncodings())
+}
+
+// compressEncoding returns the content coding of the dynamic response
+// content, checking its Content-Type against the allowed ones.
+func (c *Action) compressEncoding(content []byte) string {
+	h := c.ResponseWriter.Header()
+	if h.Get("Content-Encoding") != "" {
+		return ""
+	}
+	ct := h.Get("Content-Type")
+	if ct == "" {
+		ct = http.DetectContentType(content)
+	}
+	if !compressMimeAllowed(ct, c.App.Server.Config.CompressMimeTypes) {
+		return ""
+	}
+	return c.App.acceptEncoding(c.Request, int64(len(content)))
+}
@@ -0,0 +1,172 @@
+package xweb
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/andybalholm/brotli"
+	"github.com/go-xweb/log"
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestNegotiateEncoding(t *testing.T) {
+	offers := []string{"br", "zstd", "gzip", "deflate"}
+	tests := []struct {
+		header, encoding string
+	}{
+		{"", ""},
+		{"gzip, deflate", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"gzip;q=0.5, deflate", "deflate"},
+		{"gzip, deflate, br", "br"},
+		{"br;q=0, gzip", "gzip"},
+		{"*", "br"},
+		{"*;q=0.1, gzip", "gzip"},
+		{"identity", ""},
+		{"gzip;q=0", ""},
+	}
+	for _, test := range tests {
+		if e := negotiateEncoding(test.header, offers); e != test.encoding {
+			t.Errorf("negotiateEncoding(%q) = %q, want %q", test.header, e, test.encoding)
+		}
+	}
+}
+
+func TestCompressMimeAllowed(t *testing.T) {
+	tests := []struct {
+		contentType string
+		allowed     bool
+	}{
+		{"text/html; charset=utf-8", true},
+		{"application/json", true},
+		{"image/svg+xml", true},
+		{"image/png", false},
+		{"application/zip", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if a := compressMimeAllowed(test.contentType, nil); a != test.allowed {
+			t.Errorf("compressMimeAllowed(%q) = %v", test.contentType, a)
+		}
+	}
+	if compressMimeAllowed("text/html", []string{"application/json"}) {
+		t.Error("the configured types should replace the default ones")
+	}
+}
+
+func TestAddVary(t *testing.T) {
+	h := http.Header{}
+	h.Add("Vary", "Accept, accept-encoding")
+	addVary(h, "Accept-Encoding")
+	addVary(h, "Origin")
+	if len(h["Vary"]) != 2 || h["Vary"][1] != "Origin" {
+		t.Errorf("unexpected Vary %q", h["Vary"])
+	}
+}
+
+func TestStaticCompressConcurrent(t *testing.T) {
+	js := strings.Repeat("console.log('compressed');\n", 100)
+	s := NewServer("staticcompress")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.Config.EnableGzip = true
+	s.Config.StaticExtensionsToGzip = []string{".js"}
+	s.RootApp.AppConfig.StaticFS = fstest.MapFS{"app.js": {Data: []byte(js)}}
+	s.initServer()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 30; i++ {
+		encoding := []string{"gzip", "deflate", ""}[i%3]
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest("GET", "/app.js", nil)
+			req.Header.Set("Accept-Encoding", encoding)
+			w := httptest.NewRecorder()
+			s.ServeHTTP(w, req)
+			if got := w.Header().Get("Content-Encoding"); got != encoding {
+				t.Errorf("Accept-Encoding %q got Content-Encoding %q", encoding, got)
+			}
+			if encoding == "" && w.Body.String() != js {
+				t.Errorf("identity body is %v bytes", w.Body.Len())
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestSetBodyVary(t *testing.T) {
+	s := NewServer("setbodyvary")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.Config.EnableGzip = false
+	s.AddAction(&jsonAction{})
+	s.initServer()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/ok", nil))
+	if w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Errorf("Vary = %q without EnableGzip", w.Header().Get("Vary"))
+	}
+}
+
+func decompress(t *testing.T, content []byte, encoding string) string {
+	var r io.Reader
+	var err error
+	switch encoding {
+	case "br":
+		r = brotli.NewReader(bytes.NewReader(content))
+	case "zstd":
+		var d *zstd.Decoder
+		if d, err = zstd.NewReader(bytes.NewReader(content)); err == nil {
+			defer d.Close()
+			r = d
+		}
+	case "gzip":
+		r, err = gzip.NewReader(bytes.NewReader(content))
+	case "deflate":
+		r = flate.NewReader(bytes.NewReader(content))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%v: %v", encoding, err)
+	}
+	return string(plain)
+}
+
+func TestCompressWriterReuse(t *testing.T) {
+	for _, encoding := range defaultCompressEncodings {
+		for i, content := range []string{strings.Repeat("first response ", 100), "second"} {
+			for _, best := range []bool{false, true} {
+				compressed, err := compressBytes([]byte(content), encoding, best)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := decompress(t, compressed, encoding); got != content {
+					t.Errorf("%v %d (best %v): got %q", encoding, i, best, got)
+				}
+			}
+		}
+	}
+
+	// closing twice doesn't hand the same encoder out twice
+	w, _ := newCompressWriter(ioutil.Discard, "zstd", false)
+	w.Close()
+	w.Close()
+	a, _ := newCompressWriter(ioutil.Discard, "zstd", false)
+	b, _ := newCompressWriter(ioutil.Discard, "zstd", false)
+	if a.(*pooledWriter).WriteCloser == b.(*pooledWriter).WriteCloser {
+		t.Error("an encoder is used by two writers")
+	}
+	a.Close()
+	b.Close()
+}
@@ -0,0 +1,193 @@
+package xweb
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// scanETag returns the first entity tag of s, weak or strong, and the
+// remaining string. It returns an empty tag if s doesn't start with one.
+func scanETag(s string) (etag string, remain string) {
+	s = strings.TrimLeft(s, " \t")
+	start := 0
+	if strings.HasPrefix(s, "W/") {
+		start = 2
+	}
+	if len(s)-start < 2 || s[start] != '"' {
+		return "", ""
+	}
+	for i := start + 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"':
+			return s[:i+1], s[i+1:]
+		case c == 0x21 || c >= 0x23 && c <= 0x7E || c >= 0x80:
+		default:
+			return "", ""
+		}
+	}
+	return "", ""
+}
+
+// etagStrongMatch reports whether a and b are the same strong tag.
+func etagStrongMatch(a, b string) bool {
+	return a == b && a != "" && a[0] == '"'
+}
+
+// etagWeakMatch reports whether a and b are the same tag once their
+// weakness indicator is ignored.
+func etagWeakMatch(a, b string) bool {
+	return strings.TrimPrefix(a, "W/") == strings.TrimPrefix(b, "W/")
+}
+
+// matchETagList reports whether etag is in the If-Match or
+// If-None-Match list header, "*" matching the resource when it exists.
+func matchETagList(header, etag string, weak, exists bool) bool {
+	if strings.TrimSpace(header) == "*" {
+		return exists
+	}
+	if etag == "" {
+		return false
+	}
+	for {
+		header = strings.TrimLeft(header, " \t,")
+		if header == "" {
+			return false
+		}
+		var tag string
+		tag, header = scanETag(header)
+		if tag == "" {
+			return false
+		}
+		if weak && etagWeakMatch(tag, etag) || !weak && etagStrongMatch(tag, etag) {
+			return true
+		}
+	}
+}
+
+// unmodifiedSince reports whether modtime isn't after the date of the
+// header, which must be valid. HTTP dates have a one second precision.
+func unmodifiedSince(header string, modtime time.Time) (bool, bool) {
+	if header == "" || modtime.IsZero() || modtime.Equal(time.Unix(0, 0)) {
+		return false, false
+	}
+	t, err := http.ParseTime(header)
+	if err != nil {
+		return false, false
+	}
+	return !modtime.Truncate(time.Second).After(t), true
+}
+
+// CheckPreconditions sets the ETag and Last-Modified headers of the
+// current state of the resource and evaluates the conditional headers
+// of the request against it, in the order of RFC 7232:
+//
+//	If-Match, else If-Unmodified-Since: 412 Precondition Failed
+//	If-None-Match, else If-Modified-Since: 304 Not Modified for GET
+//	and HEAD, 412 Precondition Failed for If-None-Match otherwise
+//
+// etag is a quoted entity tag, "W/" prefixed when weak, and may be
+// empty like modtime may be zero. Without both the resource is taken as
+// missing: "*" then fails If-Match and passes If-None-Match, e.g. for a
+// PUT creating it. It returns true when the response was sent, so an
+// update handler for example does:
+//
+//	if c.CheckPreconditions(article.ETag(), article.Updated) {
+//		return nil
+//	}
+func (c *Action) CheckPreconditions(etag string, modtime time.Time) bool {
+	h := c.ResponseWriter.Header()
+	if etag != "" {
+		h.Set("ETag", etag)
+	}
+	hasModtime := !modtime.IsZero() && !modtime.Equal(time.Unix(0, 0))
+	if hasModtime {
+		h.Set("Last-Modified", webTime(modtime.UTC()))
+	}
+	exists := etag != "" || hasModtime
+
+	if im := c.Header("If-Match"); im != "" {
+		if !matchETagList(im, etag, false, exists) {
+			return c.preconditionFailed()
+		}
+	} else if ok, valid := unmodifiedSince(c.Header("If-Unmodified-Since"), modtime); valid && !ok {
+		return c.preconditionFailed()
+	}
+
+	safe := c.Method() == "GET" || c.Method() == "HEAD"
+	if inm := c.Header("If-None-Match"); inm != "" {
+		if matchETagList(inm, etag, true, exists) {
+			if safe {
+				return c.notModified()
+			}
+			return c.preconditionFailed()
+		}
+	} else if safe {
+		if ok, valid := unmodifiedSince(c.Header("If-Modified-Since"), modtime); valid && ok {
+			return c.notModified()
+		}
+	}
+	return false
+}
+
+func (c *Action) notModified() bool {
+	h := c.ResponseWriter.Header()
+	delete(h, "Content-Type")
+	delete(h, "Content-Length")
+	delete(h, "Content-Encoding")
+	c.NotModified()
+	return true
+}
+
+func (c *Action) preconditionFailed() bool {
+	c.Abort(http.StatusPreconditionFailed, statusText[http.StatusPreconditionFailed])
+	return true
+}
+
+// statusRecorder keeps the status code written by http.ServeContent.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusRecorder) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// ServeContent replies with the content of r, handling the conditional
+// headers and the Range and If-Range requests. The Content-Type comes
+// from the extension of name unless it's already set, and modtime is
+// sent as Last-Modified unless it's zero. An ETag header set before the
+// call is used for the conditional and If-Range requests.
+func (c *Action) ServeContent(name string, modtime time.Time, r io.ReadSeeker) {
+	w := &statusRecorder{ResponseWriter: c.ResponseWriter, status: http.StatusOK}
+	http.ServeContent(w, c.Request, name, modtime, r)
+	c.StatusCode = w.status
+}
+
+// acceptsRange reports whether the generated response can be served
+// partially to a Range request.
+func (c *Action) acceptsRange() bool {
+	if c.Method() != "GET" && c.Method() != "HEAD" {
+		return false
+	}
+	if c.StatusCode != 0 && c.StatusCode != http.StatusOK {
+		return false
+	}
+	return c.ResponseWriter.Header().Get("Content-Encoding") == ""
+}
+
+// serveRange serves the ranges of a generated response requested by
+// the Range header.
+func (c *Action) serveRange(content []byte) {
+	var modtime time.Time
+	if lm := c.ResponseWriter.Header().Get("Last-Modified"); lm != "" {
+		modtime, _ = http.ParseTime(lm)
+	}
+	c.ResponseWriter.Header().Set("Accept-Ranges", "bytes")
+	c.ServeContent("", modtime, bytes.NewReader(content))
+}
@@ -0,0 +1,191 @@
+package xweb
+
+import (
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-xweb/log"
+)
+
+func TestMatchETagList(t *testing.T) {
+	tests := []struct {
+		header, etag string
+		weak, exists bool
+		match        bool
+	}{
+		{`"a"`, `"a"`, false, true, true},
+		{`"b", "a"`, `"a"`, false, true, true},
+		{`W/"a"`, `"a"`, false, true, false},
+		{`W/"a"`, `"a"`, true, true, true},
+		{`"x", W/"a"`, `W/"a"`, true, true, true},
+		{`W/"a"`, `W/"a"`, false, true, false},
+		{`*`, `"a"`, false, true, true},
+		{`*`, ``, false, true, true},
+		{`*`, ``, false, false, false},
+		{`"a"`, ``, false, true, false},
+		{`"a,b"`, `"a,b"`, false, true, true},
+		{`a`, `"a"`, true, true, false},
+	}
+	for _, test := range tests {
+		if m := matchETagList(test.header, test.etag, test.weak, test.exists); m != test.match {
+			t.Errorf("matchETagList(%q, %q, %v, %v) = %v", test.header, test.etag, test.weak, test.exists, m)
+		}
+	}
+}
+
+var conditionalTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+type conditionalAction struct {
+	*Action
+	article Mapper `xweb:"GET|PUT /article"`
+	weak    Mapper `xweb:"GET /weak"`
+	dated   Mapper `xweb:"GET|PUT /dated"`
+	create  Mapper `xweb:"PUT /create"`
+	body    Mapper `xweb:"GET /body"`
+	content Mapper `xweb:"GET /content"`
+}
+
+func (c *conditionalAction) update(etag string) error {
+	if c.CheckPreconditions(etag, conditionalTime) {
+		return nil
+	}
+	if c.Method() == "PUT" {
+		return c.SetBody([]byte("updated"))
+	}
+	return c.SetBody([]byte("article"))
+}
+
+func (c *conditionalAction) Article() error {
+	return c.update(`"v2"`)
+}
+
+func (c *conditionalAction) Weak() error {
+	return c.update(`W/"w1"`)
+}
+
+func (c *conditionalAction) Dated() error {
+	return c.update("")
+}
+
+func (c *conditionalAction) Create() error {
+	if c.CheckPreconditions("", time.Time{}) {
+		return nil
+	}
+	return c.SetBody([]byte("created"))
+}
+
+func (c *conditionalAction) Body() error {
+	c.SetHeader("ETag", `"b1"`)
+	c.SetHeader("Last-Modified", webTime(conditionalTime))
+	return c.SetBody([]byte("0123456789"))
+}
+
+func (c *conditionalAction) Content() error {
+	c.SetHeader("ETag", `"c1"`)
+	c.ServeContent("digits.txt", conditionalTime, strings.NewReader("0123456789"))
+	return nil
+}
+
+func TestConditionalRequests(t *testing.T) {
+	s := NewServer("conditional")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.AddAction(&conditionalAction{})
+	s.initServer()
+
+	do := func(method, path string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Accept", "text/plain")
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+	before := webTime(conditionalTime.Add(-time.Hour))
+	after := webTime(conditionalTime.Add(time.Hour))
+
+	tests := []struct {
+		method, path string
+		header       []string
+		status       int
+		body         string
+	}{
+		{"GET", "/article", nil, 200, "article"},
+		{"GET", "/article", []string{"If-None-Match", `"v2"`}, 304, ""},
+		{"GET", "/article", []string{"If-None-Match", `W/"v2"`}, 304, ""},
+		{"GET", "/article", []string{"If-None-Match", `"v1", "v2"`}, 304, ""},
+		{"GET", "/article", []string{"If-None-Match", `"v1"`}, 200, "article"},
+		{"GET", "/article", []string{"If-None-Match", `*`}, 304, ""},
+		{"GET", "/weak", []string{"If-None-Match", `"w1"`}, 304, ""},
+		{"GET", "/weak", []string{"If-None-Match", `"x", W/"w1"`}, 304, ""},
+		{"GET", "/article", []string{"If-Modified-Since", webTime(conditionalTime)}, 304, ""},
+		{"GET", "/article", []string{"If-Modified-Since", after}, 304, ""},
+		{"GET", "/article", []string{"If-Modified-Since", before}, 200, "article"},
+		// If-None-Match takes precedence over If-Modified-Since
+		{"GET", "/article", []string{"If-None-Match", `"v1"`, "If-Modified-Since", after}, 200, "article"},
+
+		{"PUT", "/article", []string{"If-Match", `"v2"`}, 200, "updated"},
+		{"PUT", "/article", []string{"If-Match", `"v1"`}, 412, "412 Precondition Failed\nPrecondition Failed\n"},
+		{"PUT", "/article", []string{"If-Unmodified-Since", before}, 412, "412 Precondition Failed\nPrecondition Failed\n"},
+		{"PUT", "/article", []string{"If-Unmodified-Since", after}, 200, "updated"},
+		{"PUT", "/article", []string{"If-None-Match", `"v2"`}, 412, "412 Precondition Failed\nPrecondition Failed\n"},
+		{"PUT", "/dated", []string{"If-None-Match", `*`}, 412, "412 Precondition Failed\nPrecondition Failed\n"},
+		{"PUT", "/dated", []string{"If-Match", `*`}, 200, "updated"},
+		{"PUT", "/create", []string{"If-None-Match", `*`}, 200, "created"},
+		{"PUT", "/create", []string{"If-Match", `*`}, 412, "412 Precondition Failed\nPrecondition Failed\n"},
+
+		{"GET", "/body", []string{"Range", "bytes=2-4"}, 206, "234"},
+		{"GET", "/body", []string{"Range", "bytes=-3"}, 206, "789"},
+		{"GET", "/body", []string{"Range", "bytes=20-30"}, 416, ""},
+		{"GET", "/body", []string{"Range", "bytes=2-4", "If-Range", `"b1"`}, 206, "234"},
+		{"GET", "/body", []string{"Range", "bytes=2-4", "If-Range", `"b0"`}, 200, "0123456789"},
+		{"GET", "/content", []string{"Range", "bytes=5-"}, 206, "56789"},
+		{"GET", "/content", []string{"Range", "bytes=0-1", "If-Range", webTime(conditionalTime)}, 206, "01"},
+		{"GET", "/content", []string{"Range", "bytes=0-1", "If-Range", before}, 200, "0123456789"},
+		{"GET", "/content", []string{"Range", "bytes=10-"}, 416, ""},
+		{"GET", "/content", []string{"If-None-Match", `"c1"`}, 304, ""},
+	}
+	for _, test := range tests {
+		w := do(test.method, test.path, test.header...)
+		if w.Code != test.status {
+			t.Errorf("%s %s %q: got %d, want %d", test.method, test.path, test.header, w.Code, test.status)
+			continue
+		}
+		if test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s %s %q: got body %q, want %q", test.method, test.path, test.header, w.Body.String(), test.body)
+		}
+		if test.status == 304 && w.Body.Len() != 0 {
+			t.Errorf("%s %s %q: a 304 has a body %q", test.method, test.path, test.header, w.Body.String())
+		}
+	}
+
+	for _, path := range []string{"/body", "/content"} {
+		w := do("GET", path, "Range", "bytes=0-1,5-6")
+		if w.Code != 206 {
+			t.Fatalf("%s: got %d for two ranges", path, w.Code)
+		}
+		mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+		if err != nil || mediaType != "multipart/byteranges" {
+			t.Fatalf("%s: unexpected Content-Type %q", path, w.Header().Get("Content-Type"))
+		}
+		r := multipart.NewReader(w.Body, params["boundary"])
+		var parts []string
+		for {
+			p, err := r.NextPart()
+			if err != nil {
+				break
+			}
+			b, _ := ioutil.ReadAll(p)
+			parts = append(parts, p.Header.Get("Content-Range")+" "+string(b))
+		}
+		if strings.Join(parts, "|") != "bytes 0-1/10 01|bytes 5-6/10 56" {
+			t.Errorf("%s: unexpected parts %q", path, parts)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package xweb
+
+import (
+	"html/template"
+	"io"
+	"path"
+	"strings"
+	texttemplate "text/template"
+)
+
+// TemplateSource is a template file to parse, by its name under the
+// template dir.
+type TemplateSource struct {
+	Name    string
+	Content string
+}
+
+// TemplateEngine compiles the templates of the file extensions it's
+// registered for, see App.RegisterTemplateEngine.
+type TemplateEngine interface {
+	// Parse compiles a page and its layouts into one template set, the
+	// outermost layout first, so that the later sources override the
+	// blocks of the earlier ones. The funcs of the request are given as
+	// placeholders, bound by TemplateSet.Bind.
+	Parse(sources []TemplateSource, funcs template.FuncMap) (TemplateSet, error)
+}
+
+// TemplateSet is a compiled template set. It's cached and shared by the
+// requests, so it's only executed through the copies returned by Bind.
+type TemplateSet interface {
+	// Bind returns a copy of the set executing with funcs.
+	Bind(funcs template.FuncMap) (TemplateSet, error)
+	// ExecuteTemplate renders the template name of the set.
+	ExecuteTemplate(w io.Writer, name string, data interface{}) error
+}
+
+// HtmlTemplateEngine is the default engine, it parses the templates
+// with html/template.
+type HtmlTemplateEngine struct{}
+
+type htmlTemplateSet struct {
+	*template.Template
+}
+
+func (HtmlTemplateEngine) Parse(sources []TemplateSource, funcs template.FuncMap) (TemplateSet, error) {
+	root := template.New(sources[0].Name).Funcs(funcs)
+	for i, source := range sources {
+		t := root
+		if i > 0 {
+			t = root.New(source.Name)
+		}
+		if _, err := t.Parse(source.Content); err != nil {
+			return nil, err
+		}
+	}
+	return htmlTemplateSet{root}, nil
+}
+
+func (s htmlTemplateSet) Bind(funcs template.FuncMap) (TemplateSet, error) {
+	t, err := s.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return htmlTemplateSet{t.Funcs(funcs)}, nil
+}
+
+// TextTemplateEngine parses the templates with text/template, which
+// doesn't escape their output, e.g. for plain text emails or config
+// files. It's registered for the .txt files.
+type TextTemplateEngine struct{}
+
+type textTemplateSet struct {
+	*texttemplate.Template
+}
+
+func (TextTemplateEngine) Parse(sources []TemplateSource, funcs template.FuncMap) (TemplateSet, error) {
+	root := texttemplate.New(sources[0].Name).Funcs(texttemplate.FuncMap(funcs))
+	for i, source := range sources {
+		t := root
+		if i > 0 {
+			t = root.New(source.Name)
+		}
+		if _, err := t.Parse(source.Content); err != nil {
+			return nil, err
+		}
+	}
+	return textTemplateSet{root}, nil
+}
+
+func (s textTemplateSet) Bind(funcs template.FuncMap) (TemplateSet, error) {
+	t, err := s.Clone()
+	if err != nil {
+		return nil, err
+	}
+	return textTemplateSet{t.Funcs(texttemplate.FuncMap(funcs))}, nil
+}
+
+func defaultTemplateEngines() map[string]TemplateEngine {
+	return map[string]TemplateEngine{
+		"":     HtmlTemplateEngine{},
+		".txt": TextTemplateEngine{},
+	}
+}
+
+// RegisterTemplateEngine renders the templates of the file extensions,
+// e.g. ".txt", with engine, or all the others when no extension is
+// given.
+func (a *App) RegisterTemplateEngine(engine TemplateEngine, exts ...string) {
+	if a.TemplateEngines == nil {
+		a.TemplateEngines = defaultTemplateEngines()
+	}
+	if len(exts) == 0 {
+		exts = []string{""}
+	}
+	for _, ext := range exts {
+		if ext != "" && !strings.HasPrefix(ext, ".") {
+			ext = "." + ext
+		}
+		a.TemplateEngines[strings.ToLower(ext)] = engine
+	}
+}
+
+// templateEngine returns the engine of the template name.
+func (a *App) templateEngine(name string) TemplateEngine {
+	if engine, ok := a.TemplateEngines[strings.ToLower(path.Ext(name))]; ok {
+		return engine
+	}
+	if engine, ok := a.TemplateEngines[""]; ok {
+		return engine
+	}
+	return HtmlTemplateEngine{}
+}
@@ -0,0 +1,71 @@
+package xweb
+
+import (
+	"bytes"
+	"html/template"
+	"io"
+	"strings"
+	"testing"
+)
+
+type upperEngine struct{}
+
+type upperSet string
+
+func (upperEngine) Parse(sources []TemplateSource, funcs template.FuncMap) (TemplateSet, error) {
+	return upperSet(sources[len(sources)-1].Content), nil
+}
+
+func (s upperSet) Bind(funcs template.FuncMap) (TemplateSet, error) {
+	return s, nil
+}
+
+func (s upperSet) ExecuteTemplate(w io.Writer, name string, data interface{}) error {
+	_, err := io.WriteString(w, strings.ToUpper(string(s)))
+	return err
+}
+
+func TestTemplateEngines(t *testing.T) {
+	app := NewApp("/", "engines")
+	app.RegisterTemplateEngine(upperEngine{}, "up")
+	tests := map[string]string{
+		"a.html":   "&lt;b&gt;",
+		"a.htm":    "&lt;b&gt;",
+		"mail.txt": "<b>",
+		"x.UP":     "{{.}}",
+	}
+	for name, want := range tests {
+		set, err := app.templateEngine(name).Parse([]TemplateSource{{name, "{{.}}"}}, app.FuncMaps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if set, err = set.Bind(template.FuncMap{}); err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err = set.ExecuteTemplate(&buf, name, "<b>"); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != want {
+			t.Errorf("%v rendered %q, want %q", name, buf.String(), want)
+		}
+	}
+}
+
+func TestTemplateEngineBlocks(t *testing.T) {
+	sources := []TemplateSource{
+		{"layout.txt", `[{{block "body" .}}default{{end}}]`},
+		{"page.txt", `{{define "body"}}page {{.}}{{end}}`},
+	}
+	set, err := TextTemplateEngine{}.Parse(sources, template.FuncMap{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = set.ExecuteTemplate(&buf, "layout.txt", "<x>"); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[page <x>]" {
+		t.Errorf("got %q", buf.String())
+	}
+}
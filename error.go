@@ -1,10 +1,21 @@
 package xweb
 
 import (
+	"errors"
 	"fmt"
+	"html/template"
 	"net/http"
+	"strings"
+
+	"github.com/go-xweb/xweb/validation"
 )
 
+// StatusCoder is implemented by the errors returned by the handlers to
+// be sent with their status code, e.g. 404 for a missing record.
+type StatusCoder interface {
+	StatusCode() int
+}
+
 type AbortError struct {
 	Code    int
 	Content string
@@ -14,6 +25,10 @@ func (a *AbortError) Error() string {
 	return fmt.Sprintf("%v %v", a.Code, a.Content)
 }
 
+func (a *AbortError) StatusCode() int {
+	return a.Code
+}
+
 func Abort(code int, content ...string) error {
 	if len(content) >= 1 {
 		return &AbortError{code, content[0]}
@@ -40,3 +55,145 @@ func Forbidden(content ...string) error {
 func Unauthorized(content ...string) error {
 	return Abort(http.StatusUnauthorized, content...)
 }
+
+// ValidationError is the error of a request whose input failed the
+// validation, sent as a 422 with the message of each field.
+type ValidationError struct {
+	Errors []*validation.ValidationError
+}
+
+// Invalid returns the errors of v as a ValidationError, or nil when v
+// has none:
+//
+//	if err := xweb.Invalid(valid); err != nil {
+//		return err
+//	}
+func Invalid(v *validation.Validation) error {
+	if v == nil || !v.HasErrors() {
+		return nil
+	}
+	return &ValidationError{v.Errors}
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Field+": "+err.Message)
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+func (e *ValidationError) StatusCode() int {
+	return http.StatusUnprocessableEntity
+}
+
+// Fields returns the first message of each field.
+func (e *ValidationError) Fields() map[string]string {
+	fields := make(map[string]string, len(e.Errors))
+	for _, err := range e.Errors {
+		if _, ok := fields[err.Field]; !ok {
+			fields[err.Field] = err.Message
+		}
+	}
+	return fields
+}
+
+// PanicError is the error of a handler which panicked, when the server
+// recovers the panics.
+type PanicError struct {
+	Value interface{}
+	Stack string
+}
+
+func (e *PanicError) Error() string {
+	msg := fmt.Sprintf("Handler crashed with error: %v", e.Value)
+	if e.Stack != "" {
+		msg += "\n" + e.Stack
+	}
+	return msg
+}
+
+// streamError is the error of a handler whose response was partly
+// sent, it can only be logged.
+type streamError struct {
+	err error
+}
+
+func (e *streamError) Error() string {
+	return e.err.Error()
+}
+
+func (e *streamError) Unwrap() error {
+	return e.err
+}
+
+// ErrorHandler is called with the errors returned by the handlers of an
+// App and the panics they recovered from, before they're sent, e.g. to
+// report them or to map the errors of other packages:
+//
+//	app.ErrorHandler = func(c *xweb.Action, err error) error {
+//		if err == sql.ErrNoRows {
+//			return xweb.NotFound()
+//		}
+//		return err
+//	}
+//
+// The error it returns is sent like the handler had returned it, nil
+// when it sent the response itself.
+type ErrorHandler func(c *Action, err error) error
+
+// handleError sends the error returned by the handler of c, with the
+// status of the StatusCoder it wraps, and returns that status.
+func (a *App) handleError(c *Action, err error) int {
+	if a.ErrorHandler != nil {
+		if err = a.ErrorHandler(c, err); err == nil {
+			if c.StatusCode == 0 {
+				return http.StatusOK
+			}
+			return c.StatusCode
+		}
+	}
+
+	var sent *streamError
+	if errors.As(err, &sent) {
+		a.Error("Error:", err)
+		if c.StatusCode == 0 {
+			return http.StatusOK
+		}
+		return c.StatusCode
+	}
+
+	page := &ErrorPage{Status: http.StatusInternalServerError, Message: "Server Error"}
+	var abortErr *AbortError
+	var validErr *ValidationError
+	var coder StatusCoder
+	switch {
+	case isBodyTooLarge(err):
+		page.Status, page.Message = http.StatusRequestEntityTooLarge, "Request body too large"
+	case errors.As(err, &abortErr):
+		// the content of Abort is HTML, like the one of Action.Abort
+		page.Status, page.Message = abortErr.Code, template.HTML(abortErr.Content)
+	case errors.As(err, &validErr):
+		page.Status, page.Message = validErr.StatusCode(), ""
+		page.Fields = validErr.Fields()
+	case errors.As(err, &coder):
+		page.Status, page.Message = coder.StatusCode(), ""
+		if page.Status < 500 {
+			page.Message = template.HTML(template.HTMLEscapeString(err.Error()))
+		}
+	}
+	if page.Status >= 500 {
+		var panicErr *PanicError
+		if !errors.As(err, &panicErr) {
+			// SafelyCall logged the panics already
+			a.Error("Error:", err)
+		}
+		page.Stack = err.Error()
+	}
+	if page.Message == "" {
+		page.Message = template.HTML(template.HTMLEscapeString(statusText[page.Status]))
+	}
+	c.StatusCode = page.Status
+	a.errorPage(c.ResponseWriter, c.Request, page)
+	return page.Status
+}
@@ -0,0 +1,132 @@
+package xweb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-xweb/log"
+)
+
+var errNoRows = errors.New("no rows")
+
+type teapotError struct{}
+
+func (teapotError) Error() string   { return "<short> & stout" }
+func (teapotError) StatusCode() int { return 418 }
+
+type typedErrorAction struct {
+	*Action
+	missing Mapper `xweb:"/missing"`
+	teapot  Mapper `xweb:"/teapot"`
+	invalid Mapper `xweb:"/invalid"`
+	record  Mapper `xweb:"/record"`
+	down    Mapper `xweb:"/down"`
+	text    Mapper `xweb:"/text"`
+}
+
+func (a *typedErrorAction) Missing() error {
+	return NotFound("No such user")
+}
+
+func (a *typedErrorAction) Teapot() error {
+	return fmt.Errorf("brewing: %w", teapotError{})
+}
+
+func (a *typedErrorAction) Invalid() error {
+	valid := a.Validation()
+	valid.Required("", "name")
+	valid.Min(3, 18, "age")
+	return Invalid(valid)
+}
+
+func (a *typedErrorAction) Record() error {
+	return errNoRows
+}
+
+func (a *typedErrorAction) Down() error {
+	return errors.New("database is down")
+}
+
+func (a *typedErrorAction) Text() string {
+	return "hello"
+}
+
+func TestHandlerErrors(t *testing.T) {
+	s := NewServer("typederrors")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.AddAction(&typedErrorAction{})
+	var reported []error
+	s.RootApp.ErrorHandler = func(c *Action, err error) error {
+		reported = append(reported, err)
+		if err == errNoRows {
+			return NotFound("No such record")
+		}
+		return err
+	}
+	s.initServer()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	get := func(path, accept string) (int, string) {
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		req.Header.Set("Accept", accept)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, string(body)
+	}
+
+	tests := []struct {
+		path   string
+		status int
+		body   string
+	}{
+		{"/missing", 404, "404 Not Found\nNo such user\n"},
+		{"/teapot", 418, "418 I'm a teapot\nbrewing: &lt;short&gt; &amp; stout\n"},
+		{"/invalid", 422, "422 Unprocessable Entity\nUnprocessable Entity\nage: Minimum is 18\nname: Can not be empty\n"},
+		{"/record", 404, "404 Not Found\nNo such record\n"},
+		{"/down", 500, "500 Internal Server Error\nServer Error\n"},
+		{"/text", 200, "hello"},
+	}
+	for _, test := range tests {
+		if status, body := get(test.path, "text/plain"); status != test.status || body != test.body {
+			t.Errorf("GET %v = %v %q, want %v %q", test.path, status, body, test.status, test.body)
+		}
+	}
+	if len(reported) != 5 {
+		t.Errorf("reported %v errors, want 5", len(reported))
+	}
+
+	_, body := get("/invalid", "application/json")
+	var e errorJson
+	if err := json.Unmarshal([]byte(body), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.Status != 422 || len(e.Fields) != 2 || e.Fields["name"] != "Can not be empty" {
+		t.Errorf("JSON validation error = %+v", e)
+	}
+}
+
+func TestErrorHandlerResponds(t *testing.T) {
+	s := NewServer("errorhandler")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.AddAction(&typedErrorAction{})
+	s.RootApp.ErrorHandler = func(c *Action, err error) error {
+		c.ResponseWriter.WriteHeader(503)
+		return nil
+	}
+	s.initServer()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest("GET", "/down", nil))
+	if w.Code != 503 || w.Body.Len() != 0 {
+		t.Errorf("GET /down = %v %q, want 503", w.Code, w.Body.String())
+	}
+}
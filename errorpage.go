@@ -0,0 +1,194 @@
+package xweb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-xweb/uuid"
+)
+
+// ErrorPage is the data of the error templates of an App: <status>.html,
+// e.g. 404.html, or else _error.html, rendered like the other templates
+// with the T and Format funcs.
+type ErrorPage struct {
+	Status     int
+	StatusText string
+	// Message is the content given to Action.Abort, it's HTML.
+	Message template.HTML
+	// Fields are the messages of the invalid fields of a ValidationError.
+	Fields    map[string]string
+	RequestId string
+	// Stack is the stack trace of the panic of a handler, in Debug mode
+	// only.
+	Stack   string
+	Version string
+}
+
+// errorJson is the body of the errors sent to the API clients.
+type errorJson struct {
+	Status    int               `json:"status"`
+	Error     string            `json:"error"`
+	Message   string            `json:"message,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+	RequestId string            `json:"request_id,omitempty"`
+	Stack     string            `json:"stack,omitempty"`
+}
+
+type requestIdContextKey struct{}
+
+// maxRequestIdLen bounds the X-Request-Id given by the clients.
+const maxRequestIdLen = 128
+
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLen {
+		return false
+	}
+	for _, c := range id {
+		if c <= ' ' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// withRequestId returns the request with its id in the context, the
+// X-Request-Id header of the client or proxy, or else a new one, and
+// sends it back in the X-Request-Id header of the response.
+func withRequestId(req *http.Request, w http.ResponseWriter) *http.Request {
+	id := req.Header.Get("X-Request-Id")
+	if !validRequestId(id) {
+		id = strings.Replace(uuid.NewRandom().String(), "-", "", -1)
+	}
+	w.Header().Set("X-Request-Id", id)
+	return req.WithContext(context.WithValue(req.Context(), requestIdContextKey{}, id))
+}
+
+// RequestId returns the id of the request, given by the X-Request-Id
+// header or generated, e.g. to find it in the logs from an error page.
+func RequestId(req *http.Request) string {
+	if req == nil {
+		return ""
+	}
+	if id, ok := req.Context().Value(requestIdContextKey{}).(string); ok {
+		return id
+	}
+	if id := req.Header.Get("X-Request-Id"); validRequestId(id) {
+		return id
+	}
+	return ""
+}
+
+// RequestId returns the id of the request, see RequestId.
+func (c *Action) RequestId() string {
+	return RequestId(c.Request)
+}
+
+// defaultErrorPage is the template of the errors when the App has none.
+const defaultErrorPage = "xweb/error.html"
+
+// errorTemplate returns the name and the content of the error template
+// of status.
+func (a *App) errorTemplate(c *Action, status int) (string, string) {
+	for _, name := range []string{strconv.Itoa(status) + ".html", "_error.html"} {
+		if content, err := c.getTemplate(name); err == nil {
+			return name, string(content)
+		}
+	}
+	return defaultErrorPage, defaultErrorTmpl
+}
+
+// error sends the error page of status with the message content, see
+// errorPage.
+func (a *App) error(w http.ResponseWriter, req *http.Request, status int, content string) error {
+	return a.errorPage(w, req, &ErrorPage{Status: status, Message: template.HTML(content)})
+}
+
+// errorPage sends the error page, in JSON or plain text to the clients
+// preferring them to HTML, e.g. {"status": 404, "error": "Not Found",
+// "message": "Page not found", "request_id": "..."}.
+func (a *App) errorPage(w http.ResponseWriter, req *http.Request, page *ErrorPage) error {
+	if page.StatusText == "" {
+		page.StatusText = statusText[page.Status]
+		if page.StatusText == "" {
+			page.StatusText = http.StatusText(page.Status)
+		}
+	}
+	if page.RequestId == "" {
+		page.RequestId = RequestId(req)
+	}
+	if a.AppConfig.Mode != Debug {
+		page.Stack = ""
+	}
+	page.Version = Version
+
+	accept := ""
+	if req != nil {
+		accept = req.Header.Get("Accept")
+	}
+	var body []byte
+	switch negotiate(accept, []string{"text/html", "application/json", "text/plain"}) {
+	case "application/json":
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		body, _ = json.Marshal(&errorJson{page.Status, page.StatusText,
+			string(page.Message), page.Fields, page.RequestId, page.Stack})
+	case "text/plain":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		text := fmt.Sprintf("%d %s\n%s\n", page.Status, page.StatusText, page.Message)
+		fields := make([]string, 0, len(page.Fields))
+		for field := range page.Fields {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			text += field + ": " + page.Fields[field] + "\n"
+		}
+		body = []byte(text)
+	default:
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		body = a.renderErrorPage(w, req, page)
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(page.Status)
+	_, err := w.Write(body)
+	return err
+}
+
+// renderErrorPage renders the error template of the page, falling back
+// on the default one when it fails.
+func (a *App) renderErrorPage(w http.ResponseWriter, req *http.Request, page *ErrorPage) []byte {
+	if req == nil {
+		req, _ = http.NewRequest("GET", a.BasePath, nil)
+	}
+	c := &Action{
+		Request:        req,
+		App:            a,
+		ResponseWriter: w,
+		C:              reflect.ValueOf(page),
+		T:              T{},
+		f:              T{},
+	}
+	// the error pages don't open a session
+	c.lang = a.I18n.detect(c, false)
+	if c.location = a.I18n.TimeZone; c.location == nil {
+		c.location = time.Local
+	}
+	name, content := a.errorTemplate(c, page.Status)
+	body, err := c.executePage(name, content, false)
+	if err != nil && name != defaultErrorPage {
+		a.Error("render error page", name, "failed:", err)
+		body, err = c.executePage(defaultErrorPage, defaultErrorTmpl, false)
+	}
+	if err != nil {
+		a.Error("render error page failed:", err)
+		body = []byte(template.HTMLEscapeString(fmt.Sprintf("%d - %s", page.Status, page.StatusText)))
+	}
+	return body
+}
@@ -0,0 +1,98 @@
+package xweb
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-xweb/log"
+)
+
+type errorAction struct {
+	*Action
+	crash Mapper `xweb:"/crash"`
+	abort Mapper `xweb:"/abort"`
+}
+
+func (a *errorAction) Crash() {
+	panic("boom")
+}
+
+func (a *errorAction) Abort() error {
+	return a.Action.Abort(403, "Members only")
+}
+
+func TestErrorPages(t *testing.T) {
+	s := NewServer("errors")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.Config.RecoverPanic = true
+	s.RootApp.AppConfig.TemplateFS = fstest.MapFS{
+		"404.html":    {Data: []byte(`root {{.Status}} {{.Message}} {{T "xweb.back"}}`)},
+		"_error.html": {Data: []byte(`root error {{.Status}} {{.StatusText}}: {{.Message}}[{{.Stack}}]`)},
+	}
+	s.RootApp.I18n.Add("zh", map[string]interface{}{"hello": "你好"})
+	s.AddAction(&errorAction{})
+	admin := NewApp("/admin", "admin")
+	admin.AppConfig.TemplateFS = fstest.MapFS{
+		"404.html": {Data: []byte(`admin {{.Status}} {{.RequestId}}`)},
+	}
+	s.AddApp(admin)
+	s.initServer()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	get := func(path string, header ...string) (*http.Response, string) {
+		req, _ := http.NewRequest("GET", srv.URL+path, nil)
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		return resp, string(body)
+	}
+
+	tests := []struct {
+		path   string
+		header []string
+		status int
+		body   string
+	}{
+		{"/missing", nil, 404, "root 404 Page not found Back"},
+		{"/missing", []string{"Accept-Language", "zh-CN"}, 404, "root 404 Page not found 返回"},
+		{"/abort", nil, 403, "root error 403 Forbidden: Members only[]"},
+		{"/crash", nil, 500, "root error 500 Internal Server Error: Server Error[]"},
+		{"/admin/missing", []string{"X-Request-Id", "req-42"}, 404, "admin 404 req-42"},
+	}
+	for _, test := range tests {
+		resp, body := get(test.path, test.header...)
+		if resp.StatusCode != test.status || body != test.body {
+			t.Errorf("GET %v = %v %q, want %v %q", test.path, resp.StatusCode, body, test.status, test.body)
+		}
+		if resp.Header.Get("X-Request-Id") == "" {
+			t.Errorf("GET %v has no X-Request-Id", test.path)
+		}
+	}
+
+	resp, body := get("/abort", "Accept", "application/json", "X-Request-Id", "req-7")
+	var e errorJson
+	if err := json.Unmarshal([]byte(body), &e); err != nil || resp.Header.Get("Content-Type") != "application/json; charset=utf-8" {
+		t.Fatalf("JSON error = %q, %v", body, err)
+	}
+	if !reflect.DeepEqual(e, errorJson{403, "Forbidden", "Members only", nil, "req-7", ""}) {
+		t.Errorf("JSON error = %+v", e)
+	}
+
+	s.RootApp.AppConfig.Mode = Debug
+	if _, body := get("/crash"); !strings.Contains(body, "[Handler crashed with error: boom") {
+		t.Errorf("the Debug error page has no stack: %q", body)
+	}
+}
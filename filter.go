@@ -6,6 +6,9 @@ import (
 	"regexp"
 )
 
+// Filter is run on the requests before their route is resolved, so it
+// may rewrite their path, and before their body is parsed according to
+// the options of that route.
 type Filter interface {
 	Do(http.ResponseWriter, *http.Request) bool
 }
@@ -0,0 +1,453 @@
+package xweb
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LocaleFormat is how the numbers, the amounts and the dates are written
+// in a language, see I18n.Format.
+type LocaleFormat struct {
+	Decimal string // the decimal separator
+	Group   string // the thousands separator
+	// Currency and Percent are the patterns of the amounts and the
+	// percentages, # standing for the number and ¤ for the currency
+	// symbol, e.g. "# ¤" or "#%".
+	Currency string
+	Percent  string
+	// Date, Time and LongDate are the time.Format layouts of the date,
+	// time and long styles of FormatTime. January is written with Months.
+	Date     string
+	Time     string
+	LongDate string
+	Months   []string // the month names, the English ones when empty
+}
+
+// The styles of LocaleFormat.FormatTime, any other style being a
+// time.Format layout.
+const (
+	DateStyle     = "date"
+	TimeStyle     = "time"
+	DateTimeStyle = "datetime"
+	LongStyle     = "long"
+)
+
+var localeFormats = map[string]*LocaleFormat{
+	"en":    {".", ",", "¤#", "#%", "1/2/2006", "3:04 PM", "January 2, 2006", nil},
+	"en-GB": {".", ",", "¤#", "#%", "02/01/2006", "15:04", "2 January 2006", nil},
+	"de": {",", ".", "#\u00a0¤", "#\u00a0%", "02.01.2006", "15:04", "2. January 2006",
+		[]string{"Januar", "Februar", "März", "April", "Mai", "Juni", "Juli",
+			"August", "September", "Oktober", "November", "Dezember"}},
+	"fr": {",", "\u202f", "#\u00a0¤", "#\u00a0%", "02/01/2006", "15:04", "2 January 2006",
+		[]string{"janvier", "février", "mars", "avril", "mai", "juin", "juillet",
+			"août", "septembre", "octobre", "novembre", "décembre"}},
+	"es": {",", ".", "#\u00a0¤", "#\u00a0%", "2/1/2006", "15:04", "2 de January de 2006",
+		[]string{"enero", "febrero", "marzo", "abril", "mayo", "junio", "julio",
+			"agosto", "septiembre", "octubre", "noviembre", "diciembre"}},
+	"it": {",", ".", "#\u00a0¤", "#%", "02/01/2006", "15:04", "2 January 2006",
+		[]string{"gennaio", "febbraio", "marzo", "aprile", "maggio", "giugno", "luglio",
+			"agosto", "settembre", "ottobre", "novembre", "dicembre"}},
+	"nl": {",", ".", "¤\u00a0#", "#%", "02-01-2006", "15:04", "2 January 2006",
+		[]string{"januari", "februari", "maart", "april", "mei", "juni", "juli",
+			"augustus", "september", "oktober", "november", "december"}},
+	"pt": {",", ".", "¤\u00a0#", "#%", "02/01/2006", "15:04", "2 de January de 2006",
+		[]string{"janeiro", "fevereiro", "março", "abril", "maio", "junho", "julho",
+			"agosto", "setembro", "outubro", "novembro", "dezembro"}},
+	"ru": {",", "\u00a0", "#\u00a0¤", "#\u00a0%", "02.01.2006", "15:04", "2 January 2006 г.",
+		[]string{"января", "февраля", "марта", "апреля", "мая", "июня", "июля",
+			"августа", "сентября", "октября", "ноября", "декабря"}},
+	"zh": {".", ",", "¤#", "#%", "2006/1/2", "15:04", "2006年1月2日", nil},
+	"ja": {".", ",", "¤#", "#%", "2006/01/02", "15:04", "2006年1月2日", nil},
+	"ko": {".", ",", "¤#", "#%", "2006. 1. 2.", "15:04", "2006년 1월 2일", nil},
+}
+
+// currencies are the symbols and the decimals of the currencies by
+// their ISO 4217 code. The others are written with their code and two
+// decimals.
+var currencies = map[string]struct {
+	symbol   string
+	decimals int
+}{
+	"USD": {"$", 2}, "EUR": {"€", 2}, "GBP": {"£", 2}, "JPY": {"¥", 0},
+	"CNY": {"¥", 2}, "KRW": {"₩", 0}, "INR": {"₹", 2}, "RUB": {"₽", 2},
+	"BRL": {"R$", 2}, "CAD": {"CA$", 2}, "AUD": {"A$", 2}, "CHF": {"CHF", 2},
+	"HKD": {"HK$", 2}, "TWD": {"NT$", 2},
+}
+
+// Format returns the LocaleFormat of the language lang, or of its
+// parents, from Formats then from the built-in ones, English by default.
+func (i *I18n) Format(lang string) *LocaleFormat {
+	for l := normalizeLang(lang); l != ""; l = parentLang(l) {
+		if f, ok := i.Formats[l]; ok {
+			return f
+		}
+		if f, ok := localeFormats[l]; ok {
+			return f
+		}
+	}
+	return localeFormats["en"]
+}
+
+// digits writes the absolute value of the number v with its thousands
+// separators and decimals decimals, or as many as needed when decimals
+// is negative.
+func (f *LocaleFormat) digits(v interface{}, decimals int) (s string, neg bool, ok bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := rv.Int()
+		if neg = n < 0; neg {
+			s = strconv.FormatUint(uint64(-(n+1))+1, 10)
+		} else {
+			s = strconv.FormatInt(n, 10)
+		}
+		if decimals > 0 {
+			s += "." + strings.Repeat("0", decimals)
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s = strconv.FormatUint(rv.Uint(), 10)
+		if decimals > 0 {
+			s += "." + strings.Repeat("0", decimals)
+		}
+	case reflect.Float32, reflect.Float64:
+		x := rv.Float()
+		if math.IsNaN(x) || math.IsInf(x, 0) {
+			return "", false, false
+		}
+		neg = x < 0
+		s = strconv.FormatFloat(math.Abs(x), 'f', decimals, 64)
+	case reflect.String:
+		x, err := strconv.ParseFloat(rv.String(), 64)
+		if err != nil {
+			return "", false, false
+		}
+		return f.digits(x, decimals)
+	default:
+		return "", false, false
+	}
+	// no -0
+	neg = neg && strings.Trim(s, "0.") != ""
+
+	intPart, frac := s, ""
+	if dot := strings.IndexByte(s, '.'); dot >= 0 {
+		intPart, frac = s[:dot], s[dot+1:]
+	}
+	var buf strings.Builder
+	for i, c := range intPart {
+		if i > 0 && (len(intPart)-i)%3 == 0 {
+			buf.WriteString(f.Group)
+		}
+		buf.WriteRune(c)
+	}
+	if frac != "" {
+		buf.WriteString(f.Decimal)
+		buf.WriteString(frac)
+	}
+	return buf.String(), neg, true
+}
+
+// toFloat returns the number v as a float64.
+func toFloat(v interface{}) (float64, bool) {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(rv.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return rv.Float(), true
+	case reflect.String:
+		x, err := strconv.ParseFloat(rv.String(), 64)
+		return x, err == nil
+	}
+	return 0, false
+}
+
+// FormatNumber writes the number v with decimals decimals, or as many
+// as it has when decimals is negative. The values which aren't numbers
+// are written by fmt.Sprint.
+func (f *LocaleFormat) FormatNumber(v interface{}, decimals int) string {
+	s, neg, ok := f.digits(v, decimals)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	if neg {
+		return "-" + s
+	}
+	return s
+}
+
+// FormatCurrency writes the amount v in the currency of the ISO 4217
+// code, e.g. EUR, with its symbol and decimals.
+func (f *LocaleFormat) FormatCurrency(v interface{}, code string) string {
+	code = strings.ToUpper(code)
+	symbol, decimals := code, 2
+	if c, ok := currencies[code]; ok {
+		symbol, decimals = c.symbol, c.decimals
+	}
+	s, neg, ok := f.digits(v, decimals)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	s = strings.NewReplacer("#", s, "¤", symbol).Replace(f.Currency)
+	if neg {
+		return "-" + s
+	}
+	return s
+}
+
+// FormatPercent writes the ratio v as a percentage with decimals
+// decimals, e.g. 25% for 0.25.
+func (f *LocaleFormat) FormatPercent(v interface{}, decimals int) string {
+	x, ok := toFloat(v)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	s, neg, ok := f.digits(x*100, decimals)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	s = strings.Replace(f.Percent, "#", s, 1)
+	if neg {
+		return "-" + s
+	}
+	return s
+}
+
+// FormatTime writes t in the style, one of DateStyle, TimeStyle,
+// DateTimeStyle and LongStyle, or else a time.Format layout.
+func (f *LocaleFormat) FormatTime(t time.Time, style string) string {
+	layout := style
+	switch style {
+	case DateStyle:
+		layout = f.Date
+	case TimeStyle:
+		layout = f.Time
+	case DateTimeStyle:
+		layout = f.Date + " " + f.Time
+	case LongStyle:
+		layout = f.LongDate
+	}
+	if len(f.Months) != 12 || !strings.Contains(layout, "January") {
+		return t.Format(layout)
+	}
+	parts := strings.Split(layout, "January")
+	for i, part := range parts {
+		parts[i] = t.Format(part)
+	}
+	return strings.Join(parts, f.Months[t.Month()-1])
+}
+
+// relativeUnits are the units of the relative times, with the duration
+// from which they're used.
+var relativeUnits = []struct {
+	name  string
+	from  time.Duration
+	value time.Duration
+}{
+	{"year", 320 * 24 * time.Hour, 365 * 24 * time.Hour},
+	{"month", 26 * 24 * time.Hour, 30 * 24 * time.Hour},
+	{"day", 22 * time.Hour, 24 * time.Hour},
+	{"hour", 45 * time.Minute, time.Hour},
+	{"minute", 45 * time.Second, time.Minute},
+}
+
+// RelativeTime writes t relatively to now in the language lang, e.g.
+// "3 minutes ago" or "in 2 days". The messages are xweb.time.now and
+// xweb.time.ago.<unit> or xweb.time.in.<unit> for the units year, month,
+// day, hour and minute, and can be translated in the locale files.
+func (i *I18n) RelativeTime(lang string, t, now time.Time) string {
+	d := now.Sub(t)
+	dir := "ago"
+	if d < 0 {
+		d, dir = -d, "in"
+	}
+	for _, unit := range relativeUnits {
+		if d >= unit.from {
+			n := int64(math.Max(1, math.Floor(float64(d)/float64(unit.value)+0.5)))
+			return i.Tr(lang, "xweb.time."+dir+"."+unit.name, n)
+		}
+	}
+	return i.Tr(lang, "xweb.time.now")
+}
+
+func pluralMessage(one, other string) message {
+	return message{PluralOne: one, PluralOther: other}
+}
+
+// builtinMessages are the messages of xweb, looked up after the ones of
+// the App.
+var builtinMessages = map[string]map[string]message{
+	"en": {
+		"xweb.back":            {PluralOther: "Back"},
+		"xweb.time.now":        {PluralOther: "just now"},
+		"xweb.time.ago.minute": pluralMessage("%d minute ago", "%d minutes ago"),
+		"xweb.time.ago.hour":   pluralMessage("%d hour ago", "%d hours ago"),
+		"xweb.time.ago.day":    pluralMessage("%d day ago", "%d days ago"),
+		"xweb.time.ago.month":  pluralMessage("%d month ago", "%d months ago"),
+		"xweb.time.ago.year":   pluralMessage("%d year ago", "%d years ago"),
+		"xweb.time.in.minute":  pluralMessage("in %d minute", "in %d minutes"),
+		"xweb.time.in.hour":    pluralMessage("in %d hour", "in %d hours"),
+		"xweb.time.in.day":     pluralMessage("in %d day", "in %d days"),
+		"xweb.time.in.month":   pluralMessage("in %d month", "in %d months"),
+		"xweb.time.in.year":    pluralMessage("in %d year", "in %d years"),
+	},
+	"fr": {
+		"xweb.back":            {PluralOther: "Retour"},
+		"xweb.time.now":        {PluralOther: "à l'instant"},
+		"xweb.time.ago.minute": pluralMessage("il y a %d minute", "il y a %d minutes"),
+		"xweb.time.ago.hour":   pluralMessage("il y a %d heure", "il y a %d heures"),
+		"xweb.time.ago.day":    pluralMessage("il y a %d jour", "il y a %d jours"),
+		"xweb.time.ago.month":  pluralMessage("il y a %d mois", "il y a %d mois"),
+		"xweb.time.ago.year":   pluralMessage("il y a %d an", "il y a %d ans"),
+		"xweb.time.in.minute":  pluralMessage("dans %d minute", "dans %d minutes"),
+		"xweb.time.in.hour":    pluralMessage("dans %d heure", "dans %d heures"),
+		"xweb.time.in.day":     pluralMessage("dans %d jour", "dans %d jours"),
+		"xweb.time.in.month":   pluralMessage("dans %d mois", "dans %d mois"),
+		"xweb.time.in.year":    pluralMessage("dans %d an", "dans %d ans"),
+	},
+	"de": {
+		"xweb.back":            {PluralOther: "Zurück"},
+		"xweb.time.now":        {PluralOther: "gerade eben"},
+		"xweb.time.ago.minute": pluralMessage("vor %d Minute", "vor %d Minuten"),
+		"xweb.time.ago.hour":   pluralMessage("vor %d Stunde", "vor %d Stunden"),
+		"xweb.time.ago.day":    pluralMessage("vor %d Tag", "vor %d Tagen"),
+		"xweb.time.ago.month":  pluralMessage("vor %d Monat", "vor %d Monaten"),
+		"xweb.time.ago.year":   pluralMessage("vor %d Jahr", "vor %d Jahren"),
+		"xweb.time.in.minute":  pluralMessage("in %d Minute", "in %d Minuten"),
+		"xweb.time.in.hour":    pluralMessage("in %d Stunde", "in %d Stunden"),
+		"xweb.time.in.day":     pluralMessage("in %d Tag", "in %d Tagen"),
+		"xweb.time.in.month":   pluralMessage("in %d Monat", "in %d Monaten"),
+		"xweb.time.in.year":    pluralMessage("in %d Jahr", "in %d Jahren"),
+	},
+	"es": {
+		"xweb.back":            {PluralOther: "Volver"},
+		"xweb.time.now":        {PluralOther: "ahora mismo"},
+		"xweb.time.ago.minute": pluralMessage("hace %d minuto", "hace %d minutos"),
+		"xweb.time.ago.hour":   pluralMessage("hace %d hora", "hace %d horas"),
+		"xweb.time.ago.day":    pluralMessage("hace %d día", "hace %d días"),
+		"xweb.time.ago.month":  pluralMessage("hace %d mes", "hace %d meses"),
+		"xweb.time.ago.year":   pluralMessage("hace %d año", "hace %d años"),
+		"xweb.time.in.minute":  pluralMessage("dentro de %d minuto", "dentro de %d minutos"),
+		"xweb.time.in.hour":    pluralMessage("dentro de %d hora", "dentro de %d horas"),
+		"xweb.time.in.day":     pluralMessage("dentro de %d día", "dentro de %d días"),
+		"xweb.time.in.month":   pluralMessage("dentro de %d mes", "dentro de %d meses"),
+		"xweb.time.in.year":    pluralMessage("dentro de %d año", "dentro de %d años"),
+	},
+	"zh": {
+		"xweb.back":            {PluralOther: "返回"},
+		"xweb.time.now":        {PluralOther: "刚刚"},
+		"xweb.time.ago.minute": {PluralOther: "%d分钟前"},
+		"xweb.time.ago.hour":   {PluralOther: "%d小时前"},
+		"xweb.time.ago.day":    {PluralOther: "%d天前"},
+		"xweb.time.ago.month":  {PluralOther: "%d个月前"},
+		"xweb.time.ago.year":   {PluralOther: "%d年前"},
+		"xweb.time.in.minute":  {PluralOther: "%d分钟后"},
+		"xweb.time.in.hour":    {PluralOther: "%d小时后"},
+		"xweb.time.in.day":     {PluralOther: "%d天后"},
+		"xweb.time.in.month":   {PluralOther: "%d个月后"},
+		"xweb.time.in.year":    {PluralOther: "%d年后"},
+	},
+	"ja": {
+		"xweb.back":            {PluralOther: "戻る"},
+		"xweb.time.now":        {PluralOther: "たった今"},
+		"xweb.time.ago.minute": {PluralOther: "%d分前"},
+		"xweb.time.ago.hour":   {PluralOther: "%d時間前"},
+		"xweb.time.ago.day":    {PluralOther: "%d日前"},
+		"xweb.time.ago.month":  {PluralOther: "%dか月前"},
+		"xweb.time.ago.year":   {PluralOther: "%d年前"},
+		"xweb.time.in.minute":  {PluralOther: "%d分後"},
+		"xweb.time.in.hour":    {PluralOther: "%d時間後"},
+		"xweb.time.in.day":     {PluralOther: "%d日後"},
+		"xweb.time.in.month":   {PluralOther: "%dか月後"},
+		"xweb.time.in.year":    {PluralOther: "%d年後"},
+	},
+}
+
+// TimeZone returns the time zone of the request, the one named by the
+// session value I18n.TimeZoneKey, e.g. Europe/Paris, when the request
+// has a session, or I18n.TimeZone.
+func (c *Action) TimeZone() *time.Location {
+	if c.location != nil {
+		return c.location
+	}
+	i := c.App.I18n
+	c.location = i.TimeZone
+	if c.location == nil {
+		c.location = time.Local
+	}
+	if i.TimeZoneKey != "" && c.hasSession() {
+		switch tz := c.GetSession(i.TimeZoneKey).(type) {
+		case *time.Location:
+			c.location = tz
+		case string:
+			if loc, err := time.LoadLocation(tz); err == nil {
+				c.location = loc
+			}
+		}
+	}
+	return c.location
+}
+
+// SetTimeZone sets the time zone of the request by its name, e.g.
+// Europe/Paris, and keeps it in the session for the next ones.
+func (c *Action) SetTimeZone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return err
+	}
+	c.location = loc
+	if key := c.App.I18n.TimeZoneKey; key != "" && c.App.AppConfig.SessionOn && c.App.SessionManager != nil {
+		c.SetSession(key, name)
+	}
+	return nil
+}
+
+// decimalsArg returns the optional decimals argument of the format
+// helpers.
+func decimalsArg(decimals []int, dflt int) int {
+	if len(decimals) > 0 {
+		return decimals[0]
+	}
+	return dflt
+}
+
+// FormatNumber writes the number v in the language of the request, with
+// the decimals given or as many as it has. It's the FormatNumber
+// template func.
+func (c *Action) FormatNumber(v interface{}, decimals ...int) string {
+	return c.App.I18n.Format(c.Lang()).FormatNumber(v, decimalsArg(decimals, -1))
+}
+
+// FormatCurrency writes the amount v in the currency of the ISO 4217
+// code in the language of the request, e.g. {{FormatCurrency .Price "EUR"}}.
+func (c *Action) FormatCurrency(v interface{}, code string) string {
+	return c.App.I18n.Format(c.Lang()).FormatCurrency(v, code)
+}
+
+// FormatPercent writes the ratio v as a percentage in the language of
+// the request, with no decimals unless given.
+func (c *Action) FormatPercent(v interface{}, decimals ...int) string {
+	return c.App.I18n.Format(c.Lang()).FormatPercent(v, decimalsArg(decimals, 0))
+}
+
+// FormatTime writes t in the time zone and the language of the request,
+// in the style given, DateTimeStyle by default, see
+// LocaleFormat.FormatTime.
+func (c *Action) FormatTime(t time.Time, style ...string) string {
+	s := DateTimeStyle
+	if len(style) > 0 {
+		s = style[0]
+	}
+	return c.App.I18n.Format(c.Lang()).FormatTime(t.In(c.TimeZone()), s)
+}
+
+// RelativeTime writes t relatively to now in the language of the
+// request, e.g. "3 minutes ago".
+func (c *Action) RelativeTime(t time.Time) string {
+	return c.App.I18n.RelativeTime(c.Lang(), t, time.Now())
+}
@@ -0,0 +1,139 @@
+package xweb
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-xweb/log"
+)
+
+func TestLocaleFormatNumbers(t *testing.T) {
+	i := NewI18n("en")
+	en, de, fr := i.Format("en-US"), i.Format("de-AT"), i.Format("fr")
+	tests := []struct {
+		got, want string
+	}{
+		{en.FormatNumber(1234567, -1), "1,234,567"},
+		{en.FormatNumber(-1234.5, 2), "-1,234.50"},
+		{en.FormatNumber(-0.001, 2), "0.00"},
+		{de.FormatNumber(1234.5, -1), "1.234,5"},
+		{en.FormatNumber("999.999", 2), "1,000.00"},
+		{en.FormatNumber("n/a", 2), "n/a"},
+		{en.FormatCurrency(-1234.5, "usd"), "-$1,234.50"},
+		{de.FormatCurrency(1234.5, "EUR"), "1.234,50\u00a0€"},
+		{fr.FormatCurrency(1500, "JPY"), "1\u202f500\u00a0¥"},
+		{en.FormatCurrency(2, "XYZ"), "XYZ2.00"},
+		{en.FormatPercent(0.256, 1), "25.6%"},
+		{fr.FormatPercent(1, 0), "100\u00a0%"},
+		{en.FormatPercent(math.NaN(), 1), "NaN"},
+		{en.FormatPercent(math.Inf(1), 0), "+Inf"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("got %q, want %q", test.got, test.want)
+		}
+	}
+}
+
+func TestLocaleFormatTime(t *testing.T) {
+	i := NewI18n("en")
+	i.Formats["en-CA"] = &LocaleFormat{Date: "2006-01-02"}
+	tm := time.Date(2024, time.March, 5, 14, 7, 0, 0, time.UTC)
+	tests := []struct {
+		lang, style, want string
+	}{
+		{"en", DateTimeStyle, "3/5/2024 2:07 PM"},
+		{"en-GB", DateStyle, "05/03/2024"},
+		{"de", LongStyle, "5. März 2024"},
+		{"ru", LongStyle, "5 марта 2024 г."},
+		{"zh-CN", LongStyle, "2024年3月5日"},
+		{"fr", "Monday 2 January", "Tuesday 5 mars"},
+		{"en-CA", DateStyle, "2024-03-05"},
+	}
+	for _, test := range tests {
+		if got := i.Format(test.lang).FormatTime(tm, test.style); got != test.want {
+			t.Errorf("FormatTime(%v, %v) = %q, want %q", test.lang, test.style, got, test.want)
+		}
+	}
+}
+
+func TestRelativeTime(t *testing.T) {
+	i := NewI18n("en")
+	i.Add("ru", map[string]interface{}{"xweb": map[string]interface{}{"time": map[string]interface{}{"ago": map[string]interface{}{
+		"minute": map[string]interface{}{"one": "%d минуту назад", "few": "%d минуты назад", "many": "%d минут назад"},
+	}}}})
+	now := time.Date(2024, time.March, 5, 14, 0, 0, 0, time.UTC)
+	tests := []struct {
+		lang string
+		d    time.Duration
+		want string
+	}{
+		{"en", 10 * time.Second, "just now"},
+		{"en", 90 * time.Second, "2 minutes ago"},
+		{"en", time.Hour, "1 hour ago"},
+		{"en", -3 * 24 * time.Hour, "in 3 days"},
+		{"en", 400 * 24 * time.Hour, "1 year ago"},
+		{"fr-CA", 2 * time.Hour, "il y a 2 heures"},
+		{"zh", 5 * time.Minute, "5分钟前"},
+		{"ru", 3 * time.Minute, "3 минуты назад"},
+		// untranslated units fall back on English
+		{"ru", 3 * time.Hour, "3 hours ago"},
+	}
+	for _, test := range tests {
+		if got := i.RelativeTime(test.lang, now.Add(-test.d), now); got != test.want {
+			t.Errorf("RelativeTime(%v, %v) = %q, want %q", test.lang, test.d, got, test.want)
+		}
+	}
+}
+
+type timeZoneAction struct {
+	*Action
+	zone    Mapper `xweb:"/zone"`
+	setZone Mapper `xweb:"/setzone"`
+}
+
+func (a *timeZoneAction) Zone() string {
+	return a.TimeZone().String()
+}
+
+func (a *timeZoneAction) SetZone() error {
+	return a.SetTimeZone(a.GetString("tz"))
+}
+
+func TestTimeZoneSession(t *testing.T) {
+	s := NewServer("timezone")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.RootApp.AppConfig.SessionOn = true
+	s.RootApp.I18n.TimeZone = time.UTC
+	s.AddAction(&timeZoneAction{})
+	s.initServer()
+
+	get := func(path, cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/zone", "")
+	if w.Body.String() != "UTC" {
+		t.Errorf("got %q, want UTC", w.Body.String())
+	}
+	if c := w.Header().Get("Set-Cookie"); c != "" {
+		t.Errorf("reading the time zone created a session: %s", c)
+	}
+
+	cookies := get("/setzone?tz=Europe/Paris", "").Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("no session cookie")
+	}
+	if w := get("/zone", cookies[0].String()); w.Body.String() != "Europe/Paris" {
+		t.Errorf("got %q, want the time zone of the session", w.Body.String())
+	}
+}
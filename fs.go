@@ -0,0 +1,160 @@
+package xweb
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+)
+
+// DiskFS is a directory of the real disk as a fs.FS. The static and
+// template files are read through a DiskFS unless AppConfig.StaticFS or
+// AppConfig.TemplateFS is set, and only then are they watched for
+// changes.
+type DiskFS string
+
+func (dir DiskFS) fsys() fs.FS {
+	if dir == "" {
+		return os.DirFS(".")
+	}
+	return os.DirFS(string(dir))
+}
+
+func (dir DiskFS) Open(name string) (fs.File, error) {
+	return dir.fsys().Open(name)
+}
+
+func (dir DiskFS) Stat(name string) (fs.FileInfo, error) {
+	return fs.Stat(dir.fsys(), name)
+}
+
+// overlayFS looks up the files in its layers in order.
+type overlayFS []fs.FS
+
+// OverlayFS returns a fs.FS serving the files of the first layer having
+// them, e.g. a disk directory overriding some of the embedded files:
+//
+//	//go:embed static
+//	var embedded embed.FS
+//
+//	sub, _ := fs.Sub(embedded, "static")
+//	app.AppConfig.StaticFS = xweb.OverlayFS(xweb.DiskFS("custom"), sub)
+func OverlayFS(layers ...fs.FS) fs.FS {
+	return overlayFS(layers)
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	for _, layer := range o {
+		f, err := layer.Open(name)
+		if err == nil {
+			return f, nil
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+}
+
+// ReadDir merges the entries of the directory in all the layers.
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	var entries []fs.DirEntry
+	seen := make(map[string]bool)
+	found := false
+	for _, layer := range o {
+		layerEntries, err := fs.ReadDir(layer, name)
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		found = true
+		for _, entry := range layerEntries {
+			if !seen[entry.Name()] {
+				seen[entry.Name()] = true
+				entries = append(entries, entry)
+			}
+		}
+	}
+	if !found {
+		return nil, &fs.PathError{Op: "readdir", Path: name, Err: fs.ErrNotExist}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Name() < entries[j].Name()
+	})
+	return entries, nil
+}
+
+// ZipFS returns the files of a zip archive as a fs.FS, fs.Sub gives
+// the ones of one of its directories.
+func ZipFS(archive string) (fs.FS, error) {
+	return zip.OpenReader(archive)
+}
+
+// serveFSFile serves the file name of fsys.
+func serveFSFile(w http.ResponseWriter, req *http.Request, fsys fs.FS, name string, finfo fs.FileInfo) error {
+	f, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		content, err := ioutil.ReadAll(f)
+		if err != nil {
+			return err
+		}
+		rs = bytes.NewReader(content)
+	}
+	http.ServeContent(w, req, name, finfo.ModTime(), rs)
+	return nil
+}
+
+// isDiskFS reports whether fsys reads from the real disk, returning its
+// directory.
+func isDiskFS(fsys fs.FS) (string, bool) {
+	if dir, ok := fsys.(DiskFS); ok {
+		return string(dir), true
+	}
+	return "", false
+}
+
+// fsName turns a slash separated path into a fs.FS file name.
+func fsName(name string) string {
+	name = path.Clean("/" + name)[1:]
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+func (a *App) staticFS() fs.FS {
+	if a.AppConfig.StaticFS != nil {
+		return a.AppConfig.StaticFS
+	}
+	return DiskFS(a.AppConfig.StaticDir)
+}
+
+func (a *App) templateFS() fs.FS {
+	if a.AppConfig.TemplateFS != nil {
+		return a.AppConfig.TemplateFS
+	}
+	return DiskFS(a.AppConfig.TemplateDir)
+}
+
+func (a *App) localeFS() fs.FS {
+	if a.AppConfig.LocaleFS != nil {
+		return a.AppConfig.LocaleFS
+	}
+	return DiskFS(a.AppConfig.LocaleDir)
+}
@@ -0,0 +1,59 @@
+package xweb
+
+import (
+	"io/fs"
+	"testing"
+	"testing/fstest"
+)
+
+func TestOverlayFS(t *testing.T) {
+	disk := fstest.MapFS{
+		"css/app.css": {Data: []byte("custom")},
+	}
+	embedded := fstest.MapFS{
+		"css/app.css":  {Data: []byte("default")},
+		"css/base.css": {Data: []byte("base")},
+		"js/app.js":    {Data: []byte("js")},
+	}
+	o := OverlayFS(disk, embedded)
+
+	content, err := fs.ReadFile(o, "css/app.css")
+	if err != nil || string(content) != "custom" {
+		t.Errorf("expected the first layer's file, got %q, %v", content, err)
+	}
+	if content, _ = fs.ReadFile(o, "css/base.css"); string(content) != "base" {
+		t.Errorf("expected the second layer's file, got %q", content)
+	}
+	entries, err := fs.ReadDir(o, "css")
+	if err != nil || len(entries) != 2 {
+		t.Errorf("expected the merged directory, got %v, %v", entries, err)
+	}
+	if _, err = o.Open("missing.css"); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+
+	var files []string
+	fs.WalkDir(o, ".", func(p string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if len(files) != 3 {
+		t.Errorf("unexpected walked files %v", files)
+	}
+}
+
+func TestFsName(t *testing.T) {
+	for name, want := range map[string]string{
+		"/css/app.css":      "css/app.css",
+		"/":                 ".",
+		"":                  ".",
+		"/../../etc/passwd": "etc/passwd",
+		"a/./b/../c.html":   "a/c.html",
+	} {
+		if got := fsName(name); got != want {
+			t.Errorf("fsName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
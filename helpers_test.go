@@ -0,0 +1,28 @@
+package xweb
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]int64{
+		"512":    512,
+		"64k":    64 << 10,
+		"64 KB":  64 << 10,
+		"10M":    10 << 20,
+		"10mb":   10 << 20,
+		"1G":     1 << 30,
+		"2gb":    2 << 30,
+		"0":      0,
+		"100B":   100,
+		" 3 kb ": 3 << 10,
+	}
+	for s, want := range tests {
+		if got, err := parseByteSize(s); err != nil || got != want {
+			t.Errorf("parseByteSize(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "MB", "-1", "1.5M", "10TB", "ten"} {
+		if _, err := parseByteSize(s); err == nil {
+			t.Errorf("parseByteSize(%q) should fail", s)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package xweb
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"sync"
+)
+
+var ErrHubClientClosed = errors.New("the hub client is closed")
+
+// Broker carries the messages published on a Hub. The default
+// MemoryBroker only reaches the Hubs of the current process, a
+// multi-node setup implements Broker on top of its own transport so
+// that every node receives the messages published on any of them.
+type Broker interface {
+	// Publish sends the JSON encoded data to the subscribers of topic.
+	Publish(topic string, data []byte) error
+	// Subscribe calls handler for each message published on topic
+	// until the returned function is called.
+	Subscribe(topic string, handler func(topic string, data []byte)) (unsubscribe func(), err error)
+}
+
+// MemoryBroker is the in-process Broker.
+type MemoryBroker struct {
+	mutex    sync.RWMutex
+	handlers map[string]map[*memorySubscription]bool
+}
+
+type memorySubscription struct {
+	handler func(topic string, data []byte)
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{
+		handlers: make(map[string]map[*memorySubscription]bool),
+	}
+}
+
+func (b *MemoryBroker) Publish(topic string, data []byte) error {
+	b.mutex.RLock()
+	subs := make([]*memorySubscription, 0, len(b.handlers[topic]))
+	for sub := range b.handlers[topic] {
+		subs = append(subs, sub)
+	}
+	b.mutex.RUnlock()
+
+	for _, sub := range subs {
+		sub.handler(topic, data)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Subscribe(topic string, handler func(topic string, data []byte)) (func(), error) {
+	sub := &memorySubscription{handler}
+	b.mutex.Lock()
+	if b.handlers[topic] == nil {
+		b.handlers[topic] = make(map[*memorySubscription]bool)
+	}
+	b.handlers[topic][sub] = true
+	b.mutex.Unlock()
+
+	return func() {
+		b.mutex.Lock()
+		delete(b.handlers[topic], sub)
+		if len(b.handlers[topic]) == 0 {
+			delete(b.handlers, topic)
+		}
+		b.mutex.Unlock()
+	}, nil
+}
+
+// Hub dispatches the messages published on a topic, such as a chat
+// room or "order:42", to the WebSocket and SSE clients which joined it.
+//
+//	var hub = xweb.NewHub(nil)
+//
+//	func (c *RoomAction) Join(room string) error {
+//		ws := c.WebSocket()
+//		client := hub.WebSocket(ws)
+//		defer client.Close()
+//		client.Join("room:" + room)
+//		for {
+//			_, msg, err := ws.ReadMessage()
+//			if err != nil {
+//				return nil
+//			}
+//			hub.Publish("room:"+room, string(msg))
+//		}
+//	}
+//
+// Every client has a queue of BufferSize messages written by its own
+// goroutine, so a slow client never blocks the publishers.
+type Hub struct {
+	// BufferSize is the number of messages queued for a client.
+	BufferSize int
+	// DropWhenFull makes the Hub drop the messages of a client whose
+	// queue is full. By default such a client is disconnected.
+	DropWhenFull bool
+
+	broker        Broker
+	mutex         sync.Mutex
+	rooms         map[string]map[*HubClient]bool
+	unsubscribers map[string]func()
+}
+
+// NewHub returns a Hub publishing through broker, or through a new
+// MemoryBroker if broker is nil.
+func NewHub(broker Broker) *Hub {
+	if broker == nil {
+		broker = NewMemoryBroker()
+	}
+	return &Hub{
+		BufferSize:    64,
+		broker:        broker,
+		rooms:         make(map[string]map[*HubClient]bool),
+		unsubscribers: make(map[string]func()),
+	}
+}
+
+// Broker returns the Broker of the Hub.
+func (h *Hub) Broker() Broker {
+	return h.broker
+}
+
+// Publish encodes data as JSON and sends it to the clients of topic
+// on every node sharing the Broker.
+func (h *Hub) Publish(topic string, data interface{}) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	return h.broker.Publish(topic, content)
+}
+
+// Count returns the number of clients of this node in topic.
+func (h *Hub) Count(topic string) int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	return len(h.rooms[topic])
+}
+
+// Topics returns the topics having clients on this node.
+func (h *Hub) Topics() []string {
+	h.mutex.Lock()
+	topics := make([]string, 0, len(h.rooms))
+	for topic := range h.rooms {
+		topics = append(topics, topic)
+	}
+	h.mutex.Unlock()
+	sort.Strings(topics)
+	return topics
+}
+
+// deliver is the Broker handler of every topic joined on this node.
+func (h *Hub) deliver(topic string, data []byte) {
+	h.mutex.Lock()
+	var slow []*HubClient
+	for client := range h.rooms[topic] {
+		select {
+		case client.queue <- hubMessage{topic, data}:
+		default:
+			if !h.DropWhenFull {
+				slow = append(slow, client)
+			}
+		}
+	}
+	h.mutex.Unlock()
+
+	for _, client := range slow {
+		client.closeSlow()
+	}
+}
+
+func (h *Hub) join(client *HubClient, topic string) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if h.rooms[topic] == nil {
+		unsubscribe, err := h.broker.Subscribe(topic, h.deliver)
+		if err != nil {
+			return err
+		}
+		h.rooms[topic] = make(map[*HubClient]bool)
+		h.unsubscribers[topic] = unsubscribe
+	}
+	h.rooms[topic][client] = true
+	return nil
+}
+
+func (h *Hub) leave(client *HubClient, topic string) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	room, ok := h.rooms[topic]
+	if !ok {
+		return
+	}
+	delete(room, client)
+	if len(room) == 0 {
+		delete(h.rooms, topic)
+		if unsubscribe := h.unsubscribers[topic]; unsubscribe != nil {
+			unsubscribe()
+		}
+		delete(h.unsubscribers, topic)
+	}
+}
+
+type hubMessage struct {
+	topic string
+	data  []byte
+}
+
+// HubClient is a connection subscribed to topics of a Hub.
+type HubClient struct {
+	hub     *Hub
+	send    func(topic string, data []byte) error
+	onSlow  func()
+	queue   chan hubMessage
+	done    chan struct{}
+	connEnd <-chan struct{}
+
+	mutex     sync.Mutex
+	topics    map[string]bool
+	closeOnce sync.Once
+}
+
+// NewClient returns a client of the Hub writing its messages with
+// send, which is never called concurrently.
+func (h *Hub) NewClient(send func(topic string, data []byte) error) *HubClient {
+	return h.newClient(send, nil, nil)
+}
+
+// WebSocket returns a client of the Hub sending its messages to ws as
+// text messages like {"topic":"order:42","data":...}. A client too
+// slow to keep up is closed with ClosePolicyViolation.
+func (h *Hub) WebSocket(ws *WebSocketConn) *HubClient {
+	return h.newClient(func(topic string, data []byte) error {
+		return ws.WriteJSON(struct {
+			Topic string          `json:"topic"`
+			Data  json.RawMessage `json:"data"`
+		}{topic, data})
+	}, func() {
+		ws.Close(ClosePolicyViolation, "too slow")
+	}, nil)
+}
+
+// EventStream returns a client of the Hub sending its messages to s as
+// events named after their topic. The client is closed when the
+// stream ends, so the handler can wait for Done.
+func (h *Hub) EventStream(s *EventStream) *HubClient {
+	return h.newClient(func(topic string, data []byte) error {
+		return s.Send(topic, "", data)
+	}, nil, s.Done())
+}
+
+func (h *Hub) newClient(send func(string, []byte) error, onSlow func(), connEnd <-chan struct{}) *HubClient {
+	size := h.BufferSize
+	if size <= 0 {
+		size = 1
+	}
+	client := &HubClient{
+		hub:     h,
+		send:    send,
+		onSlow:  onSlow,
+		queue:   make(chan hubMessage, size),
+		done:    make(chan struct{}),
+		connEnd: connEnd,
+		topics:  make(map[string]bool),
+	}
+	go client.writeLoop()
+	return client
+}
+
+func (client *HubClient) writeLoop() {
+	for {
+		select {
+		case <-client.done:
+			return
+		case <-client.connEnd:
+			client.Close()
+			return
+		case msg := <-client.queue:
+			if err := client.send(msg.topic, msg.data); err != nil {
+				client.Close()
+				return
+			}
+		}
+	}
+}
+
+// Join subscribes the client to topics.
+func (client *HubClient) Join(topics ...string) error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	if client.isClosed() {
+		return ErrHubClientClosed
+	}
+	for _, topic := range topics {
+		if client.topics[topic] {
+			continue
+		}
+		if err := client.hub.join(client, topic); err != nil {
+			return err
+		}
+		client.topics[topic] = true
+	}
+	return nil
+}
+
+// Leave unsubscribes the client from topics.
+func (client *HubClient) Leave(topics ...string) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+	for _, topic := range topics {
+		if client.topics[topic] {
+			client.hub.leave(client, topic)
+			delete(client.topics, topic)
+		}
+	}
+}
+
+// Topics returns the topics the client joined.
+func (client *HubClient) Topics() []string {
+	client.mutex.Lock()
+	topics := make([]string, 0, len(client.topics))
+	for topic := range client.topics {
+		topics = append(topics, topic)
+	}
+	client.mutex.Unlock()
+	sort.Strings(topics)
+	return topics
+}
+
+// Done returns a channel closed once the client is closed, because
+// Close was called, the connection ended or it was too slow.
+func (client *HubClient) Done() <-chan struct{} {
+	return client.done
+}
+
+func (client *HubClient) isClosed() bool {
+	select {
+	case <-client.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Close leaves all the topics and stops the client. It doesn't close
+// the underlying connection.
+func (client *HubClient) Close() {
+	client.closeOnce.Do(func() {
+		client.mutex.Lock()
+		close(client.done)
+		for topic := range client.topics {
+			client.hub.leave(client, topic)
+		}
+		client.topics = make(map[string]bool)
+		client.mutex.Unlock()
+	})
+}
+
+func (client *HubClient) closeSlow() {
+	client.Close()
+	if client.onSlow != nil {
+		client.onSlow()
+	}
+}
@@ -0,0 +1,69 @@
+package xweb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestHub(t *testing.T) {
+	hub := NewHub(nil)
+	received := make(chan string, 10)
+	client := hub.NewClient(func(topic string, data []byte) error {
+		received <- topic + " " + string(data)
+		return nil
+	})
+	client.Join("order:42", "order:43")
+	if n := hub.Count("order:42"); n != 1 {
+		t.Fatalf("expected 1 client in order:42, got %d", n)
+	}
+
+	hub.Publish("order:42", map[string]string{"status": "paid"})
+	hub.Publish("order:44", "ignored")
+	client.Leave("order:43")
+	hub.Publish("order:43", "ignored")
+	// the messages of a client are sent in order, the ignored ones
+	// would come before this one
+	hub.Publish("order:42", "last")
+
+	for _, want := range []string{`order:42 {"status":"paid"}`, `order:42 "last"`} {
+		select {
+		case msg := <-received:
+			if msg != want {
+				t.Errorf("got message %q, want %q", msg, want)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("timed out waiting for %q", want)
+		}
+	}
+
+	client.Close()
+	if n := hub.Count("order:42"); n != 0 {
+		t.Errorf("expected an empty room after Close, got %d", n)
+	}
+	if topics := hub.Topics(); len(topics) != 0 {
+		t.Errorf("expected no topics, got %v", topics)
+	}
+}
+
+func TestHubSlowClient(t *testing.T) {
+	hub := NewHub(nil)
+	hub.BufferSize = 1
+	block := make(chan struct{})
+	defer close(block)
+	client := hub.NewClient(func(topic string, data []byte) error {
+		<-block
+		return nil
+	})
+	client.Join("news")
+	for i := 0; i < 5; i++ {
+		hub.Publish("news", i)
+	}
+	select {
+	case <-client.Done():
+	case <-time.After(time.Second):
+		t.Fatal("slow client was not disconnected")
+	}
+	if hub.Count("news") != 0 {
+		t.Error("slow client still in the room")
+	}
+}
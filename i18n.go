@@ -0,0 +1,444 @@
+package xweb
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-xweb/xweb/validation"
+)
+
+// I18n keeps the messages of an App translated in several languages, by
+// key. They're loaded from the JSON, TOML or gettext .po files of
+// AppConfig.LocaleDir, see LoadFS, and translated in the language of the
+// request by Action.Tr or the T template func:
+//
+//	{{T "cart.items" .Count}}
+//
+// with locales/en.json:
+//
+//	{"cart": {"items": {"one": "%d item", "other": "%d items"}}}
+type I18n struct {
+	// Default is the language of the requests asking for none of the
+	// loaded ones, and the last fallback of the messages.
+	Default string
+	// Fallbacks are the languages whose messages are used when a
+	// language lacks one, before its parent languages, e.g. en-NZ falls
+	// back on the Fallbacks["en-NZ"] languages, then on en.
+	Fallbacks map[string][]string
+	// URLPrefix detects the language from the first segment of the path
+	// under the App, e.g. /fr/about, which is removed before routing.
+	URLPrefix bool
+	// QueryName, CookieName and SessionKey are where the language of
+	// the request is looked for, after the URL prefix and before the
+	// Accept-Language header. They are "lang" by default, empty
+	// disables them.
+	QueryName  string
+	CookieName string
+	SessionKey string
+	// Formats override the built-in LocaleFormat of the languages.
+	Formats map[string]*LocaleFormat
+	// TimeZoneKey is the session value of the time zone of the user,
+	// "tz" by default, see Action.TimeZone. TimeZone is the time zone
+	// of the others, time.Local when nil.
+	TimeZoneKey string
+	TimeZone    *time.Location
+
+	mutex    sync.RWMutex
+	messages map[string]map[string]message // by language and key
+}
+
+// NewI18n returns an I18n of the default language defaultLang.
+func NewI18n(defaultLang string) *I18n {
+	return &I18n{
+		Default:     defaultLang,
+		Fallbacks:   make(map[string][]string),
+		QueryName:   "lang",
+		CookieName:  "lang",
+		SessionKey:  "lang",
+		Formats:     make(map[string]*LocaleFormat),
+		TimeZoneKey: "tz",
+		messages:    make(map[string]map[string]message),
+	}
+}
+
+// normalizeLang returns the canonical form of the language tag, e.g.
+// zh-Hant-TW for zh_hant_tw or en-US for en_US.UTF-8.
+func normalizeLang(tag string) string {
+	if i := strings.IndexAny(tag, ".@"); i >= 0 {
+		tag = tag[:i]
+	}
+	parts := strings.Split(strings.Replace(strings.TrimSpace(tag), "_", "-", -1), "-")
+	for i, part := range parts {
+		switch {
+		case i == 0:
+			parts[i] = strings.ToLower(part)
+		case len(part) == 2:
+			parts[i] = strings.ToUpper(part)
+		case len(part) == 4:
+			parts[i] = strings.ToUpper(part[:1]) + strings.ToLower(part[1:])
+		default:
+			parts[i] = strings.ToLower(part)
+		}
+	}
+	return strings.Join(parts, "-")
+}
+
+// parentLang returns the language lang is a variant of, e.g. zh-Hant
+// for zh-Hant-TW, or an empty string.
+func parentLang(lang string) string {
+	if i := strings.LastIndex(lang, "-"); i > 0 {
+		return lang[:i]
+	}
+	return ""
+}
+
+func (i *I18n) addMessages(lang string, messages map[string]message) {
+	lang = normalizeLang(lang)
+	i.mutex.Lock()
+	defer i.mutex.Unlock()
+	if i.messages == nil {
+		i.messages = make(map[string]map[string]message)
+	}
+	if i.messages[lang] == nil {
+		i.messages[lang] = make(map[string]message)
+	}
+	for key, msg := range messages {
+		i.messages[lang][key] = msg
+	}
+}
+
+// Add adds the messages of the language lang, by key. A message is a
+// string, or a table of messages whose keys are prefixed by its own,
+// or a table of plural forms by category:
+//
+//	i18n.Add("en", map[string]interface{}{
+//		"hello": "Hello %v",
+//		"cart": map[string]interface{}{
+//			"items": map[string]interface{}{"one": "%d item", "other": "%d items"},
+//		},
+//	})
+func (i *I18n) Add(lang string, messages map[string]interface{}) error {
+	flat, err := flattenMessages(messages)
+	if err != nil {
+		return err
+	}
+	i.addMessages(lang, flat)
+	return nil
+}
+
+// LoadFile adds the messages of the locale file name in the language
+// lang. The format is given by the extension of name: .json, .toml or
+// .po.
+func (i *I18n) LoadFile(lang, name string, content []byte) error {
+	messages, err := parseLocaleFile(normalizeLang(lang), name, content)
+	if err != nil {
+		return err
+	}
+	i.addMessages(lang, messages)
+	return nil
+}
+
+// LoadFS adds the messages of the locale files of dir in fsys. Their
+// language is given by their name, e.g. fr.json, or by the name of
+// their directory, e.g. fr/LC_MESSAGES/app.po.
+func (i *I18n) LoadFS(fsys fs.FS, dir string) error {
+	return fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") && name != dir {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		switch strings.ToLower(path.Ext(name)) {
+		case ".json", ".toml", ".po":
+		default:
+			return nil
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		rel := name
+		if dir != "." {
+			rel = strings.TrimPrefix(name, dir+"/")
+		}
+		lang := strings.SplitN(rel, "/", 2)[0]
+		if lang == rel {
+			lang = strings.TrimSuffix(rel, path.Ext(rel))
+		}
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		return i.LoadFile(lang, name, content)
+	})
+}
+
+// Languages returns the sorted languages having messages.
+func (i *I18n) Languages() []string {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	langs := make([]string, 0, len(i.messages))
+	for lang := range i.messages {
+		langs = append(langs, lang)
+	}
+	sort.Strings(langs)
+	return langs
+}
+
+func (i *I18n) has(lang string) bool {
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	_, ok := i.messages[lang]
+	return ok
+}
+
+// Match returns the first of the language tags having messages, by
+// themselves, by their parent languages or by one of their variants,
+// e.g. en-US for en. It returns an empty string when none matches.
+func (i *I18n) Match(tags ...string) string {
+	langs := i.Languages()
+	for _, tag := range tags {
+		if tag = normalizeLang(tag); tag == "" {
+			continue
+		}
+		for lang := tag; lang != ""; lang = parentLang(lang) {
+			if i.has(lang) {
+				return lang
+			}
+		}
+		for _, lang := range langs {
+			if strings.HasPrefix(lang, tag+"-") {
+				return lang
+			}
+		}
+	}
+	return ""
+}
+
+// matchAcceptLanguage returns the loaded language preferred by the
+// Accept-Language header.
+func (i *I18n) matchAcceptLanguage(header string) string {
+	ranges := parseAccept(header)
+	sort.SliceStable(ranges, func(a, b int) bool {
+		return ranges[a].q > ranges[b].q
+	})
+	var tags []string
+	for _, r := range ranges {
+		if r.q > 0 && r.mediaType != "*/*" {
+			tags = append(tags, r.mediaType)
+		}
+	}
+	return i.Match(tags...)
+}
+
+// chain returns the languages whose messages are looked up for lang, in
+// order: lang and its Fallbacks, its parents and theirs, the parents of
+// the fallbacks and Default.
+func (i *I18n) chain(lang string) []string {
+	var chain []string
+	seen := make(map[string]bool)
+	add := func(lang string) {
+		if lang = normalizeLang(lang); lang != "" && !seen[lang] {
+			seen[lang] = true
+			chain = append(chain, lang)
+		}
+	}
+	for l := normalizeLang(lang); l != ""; l = parentLang(l) {
+		add(l)
+		for key, fallbacks := range i.Fallbacks {
+			if normalizeLang(key) == l {
+				for _, fallback := range fallbacks {
+					add(fallback)
+				}
+			}
+		}
+	}
+	for _, l := range append([]string(nil), chain...) {
+		for l = parentLang(l); l != ""; l = parentLang(l) {
+			add(l)
+		}
+	}
+	for l := normalizeLang(i.Default); l != ""; l = parentLang(l) {
+		add(l)
+	}
+	return chain
+}
+
+// lookup returns the message key of lang or of its fallbacks, with the
+// language it's written in. The built-in messages come last.
+func (i *I18n) lookup(lang, key string) (message, string, bool) {
+	chain := i.chain(lang)
+	i.mutex.RLock()
+	defer i.mutex.RUnlock()
+	for _, l := range chain {
+		if msg, ok := i.messages[l][key]; ok {
+			return msg, l, true
+		}
+	}
+	for _, l := range chain {
+		if msg, ok := builtinMessages[l][key]; ok {
+			return msg, l, true
+		}
+	}
+	return nil, "", false
+}
+
+// pluralCount returns the first of args when it's an integer.
+func pluralCount(args []interface{}) (int64, bool) {
+	if len(args) == 0 || args[0] == nil {
+		return 0, false
+	}
+	v := reflect.ValueOf(args[0])
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return int64(v.Uint()), true
+	}
+	return 0, false
+}
+
+// form returns the plural form of msg for the count of args in lang,
+// the zero form being used for 0 in all the languages having one.
+func (msg message) form(lang string, args []interface{}) string {
+	if n, ok := pluralCount(args); ok && len(msg) > 1 {
+		if s, ok := msg[PluralZero]; ok && n == 0 {
+			return s
+		}
+		if s, ok := msg[PluralCategory(lang, n)]; ok {
+			return s
+		}
+	}
+	return msg[PluralOther]
+}
+
+// Tr returns the message key in the language lang, or in its fallbacks,
+// formatted with args by fmt.Sprintf. The plural form is chosen by the
+// first of args when it's an integer. The key itself is returned when
+// no language has it.
+func (i *I18n) Tr(lang, key string, args ...interface{}) string {
+	text := key
+	if msg, msgLang, ok := i.lookup(lang, key); ok {
+		text = msg.form(msgLang, args)
+	}
+	if len(args) > 0 && strings.Contains(text, "%") {
+		text = fmt.Sprintf(text, args...)
+	}
+	return text
+}
+
+type langContextKey struct{}
+
+// stripPrefix removes the language prefix of the path of req under the
+// App base path, returning the request with its language in the context.
+func (i *I18n) stripPrefix(basePath string, req *http.Request) *http.Request {
+	basePath = strings.TrimRight(basePath, "/")
+	if !strings.HasPrefix(req.URL.Path, basePath+"/") {
+		return req
+	}
+	rest := req.URL.Path[len(basePath)+1:]
+	segment := rest
+	if slash := strings.Index(rest, "/"); slash >= 0 {
+		segment, rest = rest[:slash], rest[slash:]
+	} else {
+		rest = "/"
+	}
+	lang := normalizeLang(segment)
+	if segment == "" || !i.has(lang) {
+		return req
+	}
+
+	r := req.WithContext(context.WithValue(req.Context(), langContextKey{}, lang))
+	u := *req.URL
+	u.Path, u.RawPath = basePath+rest, ""
+	r.URL = &u
+	return r
+}
+
+// detect returns the language of the request of the action, from the
+// URL prefix, the query, the cookie, the session when useSession and
+// the request has one, or the Accept-Language header, in that order, or
+// Default.
+func (i *I18n) detect(c *Action, useSession bool) string {
+	if lang, ok := c.Request.Context().Value(langContextKey{}).(string); ok {
+		return lang
+	}
+	if i.QueryName != "" {
+		if lang := i.Match(c.Request.URL.Query().Get(i.QueryName)); lang != "" {
+			return lang
+		}
+	}
+	if i.CookieName != "" {
+		if lang := i.Match(c.Cookie(i.CookieName)); lang != "" {
+			return lang
+		}
+	}
+	if useSession && i.SessionKey != "" && c.hasSession() {
+		if s, ok := c.GetSession(i.SessionKey).(string); ok {
+			if lang := i.Match(s); lang != "" {
+				return lang
+			}
+		}
+	}
+	if lang := i.matchAcceptLanguage(c.Request.Header.Get("Accept-Language")); lang != "" {
+		return lang
+	}
+	return normalizeLang(i.Default)
+}
+
+// Lang returns the language of the request, see I18n.
+func (c *Action) Lang() string {
+	if c.lang == "" {
+		c.lang = c.App.I18n.detect(c, true)
+	}
+	return c.lang
+}
+
+// SetLang sets the language of the request, and of the next ones of the
+// client through the language cookie.
+func (c *Action) SetLang(lang string) {
+	i := c.App.I18n
+	if matched := i.Match(lang); matched != "" {
+		lang = matched
+	}
+	c.lang = normalizeLang(lang)
+	if i.CookieName != "" {
+		cookie := NewCookie(i.CookieName, c.lang, 365*24*3600)
+		cookie.Path = c.App.BasePath
+		c.SetCookie(cookie)
+	}
+}
+
+// Tr returns the message key in the language of the request, formatted
+// with args, see I18n.Tr. It's the T template func.
+func (c *Action) Tr(key string, args ...interface{}) string {
+	return c.App.I18n.Tr(c.Lang(), key, args...)
+}
+
+// Validation returns a validation context whose messages are in the
+// language of the request. The message template of a validator is the
+// message validation.<name>, e.g. validation.Required, or the one of
+// validation.MessageTmpls.
+func (c *Action) Validation() *validation.Validation {
+	lang := c.Lang()
+	tmpls := make(map[string]string, len(validation.MessageTmpls))
+	for name, tmpl := range validation.MessageTmpls {
+		if msg, _, ok := c.App.I18n.lookup(lang, "validation."+name); ok {
+			tmpl = msg[PluralOther]
+		}
+		tmpls[name] = tmpl
+	}
+	return &validation.Validation{MessageTmpls: tmpls}
+}
@@ -0,0 +1,183 @@
+package xweb
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-xweb/log"
+)
+
+func TestPluralCategory(t *testing.T) {
+	tests := []struct {
+		lang string
+		n    int64
+		want string
+	}{
+		{"en", 1, PluralOne}, {"en", 0, PluralOther}, {"en-US", 2, PluralOther},
+		{"fr", 0, PluralOne}, {"fr", 2, PluralOther},
+		{"zh-CN", 1, PluralOther},
+		{"ru", 21, PluralOne}, {"ru", 11, PluralMany}, {"ru", 23, PluralFew}, {"ru", 14, PluralMany},
+		{"pl", 1, PluralOne}, {"pl", 22, PluralFew}, {"pl", 21, PluralMany},
+		{"cs", 3, PluralFew}, {"cs", 5, PluralOther},
+		{"ar", 2, PluralTwo}, {"ar", 105, PluralFew}, {"ar", 111, PluralMany}, {"ar", 100, PluralOther},
+	}
+	for _, test := range tests {
+		if got := PluralCategory(test.lang, test.n); got != test.want {
+			t.Errorf("PluralCategory(%v, %v) = %v, want %v", test.lang, test.n, got, test.want)
+		}
+	}
+}
+
+func TestI18nLoadFS(t *testing.T) {
+	i := NewI18n("en")
+	fsys := fstest.MapFS{
+		"en.json": {Data: []byte(`{"hello": "Hello %v", "cart": {"items": {"zero": "No items", "one": "%d item", "other": "%d items"}}}`)},
+		"fr.toml": {Data: []byte("hello = \"Bonjour %v\" # greeting\n[cart.items]\none = '%d article'\nother = \"%d articles\"\n")},
+		"ru/LC_MESSAGES/app.po": {Data: []byte(`msgid ""
+msgstr ""
+"Plural-Forms: nplurals=3;\n"
+
+msgid "cart.items"
+msgid_plural "%d items"
+msgstr[0] "%d товар"
+msgstr[1] "%d товара"
+msgstr[2] "%d "
+"товаров"
+
+#, fuzzy
+msgid "hello"
+msgstr "Привет %v"
+`)},
+	}
+	if err := i.LoadFS(fsys, "."); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		lang, key string
+		args      []interface{}
+		want      string
+	}{
+		{"en", "hello", []interface{}{"Bob"}, "Hello Bob"},
+		{"en", "cart.items", []interface{}{0}, "No items"},
+		{"en", "cart.items", []interface{}{1}, "1 item"},
+		{"fr-CA", "hello", []interface{}{"Bob"}, "Bonjour Bob"},
+		{"fr", "cart.items", []interface{}{0}, "0 article"},
+		{"ru", "cart.items", []interface{}{3}, "3 товара"},
+		{"ru", "cart.items", []interface{}{5}, "5 товаров"},
+		// the fuzzy entry falls back on the default language
+		{"ru", "hello", []interface{}{"Bob"}, "Hello Bob"},
+		{"de", "missing.key", nil, "missing.key"},
+	}
+	for _, test := range tests {
+		if got := i.Tr(test.lang, test.key, test.args...); got != test.want {
+			t.Errorf("Tr(%v, %v, %v) = %q, want %q", test.lang, test.key, test.args, got, test.want)
+		}
+	}
+}
+
+func TestI18nFallbacks(t *testing.T) {
+	i := NewI18n("en")
+	i.Add("en", map[string]interface{}{"color": "color", "truck": "truck"})
+	i.Add("en-GB", map[string]interface{}{"color": "colour"})
+	i.Add("en-AU", map[string]interface{}{"truck": "ute"})
+	i.Fallbacks["en-NZ"] = []string{"en-AU", "en-GB"}
+	if got := i.Tr("en-NZ", "color") + " " + i.Tr("en_nz", "truck"); got != "colour ute" {
+		t.Errorf("en-NZ = %v", got)
+	}
+	if got := i.chain("zh-Hant-TW"); len(got) != 4 || got[0] != "zh-Hant-TW" || got[2] != "zh" || got[3] != "en" {
+		t.Errorf("chain = %v", got)
+	}
+}
+
+func TestI18nMatch(t *testing.T) {
+	i := NewI18n("en")
+	for _, lang := range []string{"en", "fr", "pt-BR"} {
+		i.Add(lang, map[string]interface{}{"k": lang})
+	}
+	tests := map[string]string{
+		"fr-CA, en;q=0.8":        "fr",
+		"de, en;q=0.5, fr;q=0.7": "fr",
+		"pt":                     "pt-BR",
+		"de, *;q=0.1":            "",
+	}
+	for header, want := range tests {
+		if got := i.matchAcceptLanguage(header); got != want {
+			t.Errorf("matchAcceptLanguage(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestI18nStripPrefix(t *testing.T) {
+	i := NewI18n("en")
+	i.Add("fr", map[string]interface{}{"k": "v"})
+	tests := []struct {
+		base, path, want, lang string
+	}{
+		{"/", "/fr/about", "/about", "fr"},
+		{"/", "/fr", "/", "fr"},
+		{"/admin/", "/admin/fr/users", "/admin/users", "fr"},
+		{"/", "/fresh/x", "/fresh/x", ""},
+	}
+	for _, test := range tests {
+		req := i.stripPrefix(test.base, httptest.NewRequest("GET", test.path, nil))
+		lang, _ := req.Context().Value(langContextKey{}).(string)
+		if req.URL.Path != test.want || lang != test.lang {
+			t.Errorf("stripPrefix(%v) = %v %q, want %v %q", test.path, req.URL.Path, lang, test.want, test.lang)
+		}
+	}
+}
+
+type langAction struct {
+	*Action
+	lang    Mapper `xweb:"/lang"`
+	setLang Mapper `xweb:"/setlang"`
+}
+
+func (a *langAction) Lang() string {
+	return a.Action.Lang()
+}
+
+func (a *langAction) SetLang() string {
+	a.SetSession("lang", a.GetString("lang"))
+	return "ok"
+}
+
+func TestI18nDetectSession(t *testing.T) {
+	s := NewServer("lang")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.RootApp.AppConfig.SessionOn = true
+	s.RootApp.I18n.Add("fr", map[string]interface{}{"k": "v"})
+	s.RootApp.I18n.Add("de", map[string]interface{}{"k": "v"})
+	s.AddAction(&langAction{})
+	s.initServer()
+
+	get := func(path, cookie string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept-Language", "de")
+		if cookie != "" {
+			req.Header.Set("Cookie", cookie)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	w := get("/lang", "")
+	if w.Body.String() != "de" {
+		t.Errorf("got %q, want the language of Accept-Language", w.Body.String())
+	}
+	if c := w.Header().Get("Set-Cookie"); c != "" {
+		t.Errorf("detecting the language created a session: %s", c)
+	}
+
+	cookies := get("/setlang?lang=fr", "").Result().Cookies()
+	if len(cookies) == 0 {
+		t.Fatal("no session cookie")
+	}
+	if w := get("/lang", cookies[0].String()); w.Body.String() != "fr" {
+		t.Errorf("got %q, want the language of the session", w.Body.String())
+	}
+}
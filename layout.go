@@ -0,0 +1,133 @@
+package xweb
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// maxLayoutDepth bounds the nesting of the layouts.
+const maxLayoutDepth = 10
+
+// layoutRegexp finds the {{layout "name"}} declaration of a template.
+var layoutRegexp = regexp.MustCompile(`\{\{-?\s*layout\s+"([^"]+)"\s*-?\}\}`)
+
+// declaredLayout returns the layout a template declares with
+// {{layout "name"}}.
+func declaredLayout(content string) string {
+	if m := layoutRegexp.FindStringSubmatch(content); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// layoutFunc is the layout template func. The declaration is read
+// before parsing, so it outputs nothing.
+func layoutFunc(name string) string {
+	return ""
+}
+
+// SetLayout sets the layout of the pages rendered by the action,
+// overriding the ones they declare and AppConfig.Layout. An empty name
+// renders them without a layout.
+func (c *Action) SetLayout(name string) {
+	c.layout = &name
+}
+
+// layoutChain returns the page followed by its layouts, innermost
+// first. Render applies AppConfig.Layout to the pages of its extension
+// when neither the action nor the page chose one.
+func (c *Action) layoutChain(name, content string, useDefault bool) ([]TemplateSource, error) {
+	chain := []TemplateSource{{name, content}}
+	var layout string
+	if c.layout != nil {
+		layout = *c.layout
+	} else if layout = declaredLayout(content); layout == "" && useDefault {
+		if dflt := c.App.AppConfig.Layout; name != dflt && path.Ext(name) == path.Ext(dflt) {
+			layout = dflt
+		}
+	}
+	seen := map[string]bool{name: true}
+	for layout != "" {
+		if seen[layout] {
+			return nil, fmt.Errorf("layout %v of %v is recursive", layout, chain[len(chain)-1].Name)
+		}
+		if len(chain) > maxLayoutDepth {
+			return nil, fmt.Errorf("layouts of %v are nested too deep", name)
+		}
+		seen[layout] = true
+		layoutContent, err := c.getTemplate(layout)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, TemplateSource{layout, string(layoutContent)})
+		layout = declaredLayout(string(layoutContent))
+	}
+	return chain, nil
+}
+
+// parseTemplates compiles the page and its layouts with the engine of
+// the page. The sets are kept by the TemplateMgr when the templates are
+// cached, so they are executed through TemplateSet.Bind.
+func (a *App) parseTemplates(chain []TemplateSource, funcs template.FuncMap) (TemplateSet, error) {
+	names := make([]string, len(chain))
+	contents := make([]string, len(chain))
+	for i, page := range chain {
+		names[i], contents[i] = page.Name, page.Content
+	}
+	key := strings.Join(names, "\x00")
+	cache := a.AppConfig.CacheTemplates && a.TemplateMgr.parsed != nil
+	if cache {
+		if set, ok := a.TemplateMgr.GetParsed(key, contents); ok {
+			return set, nil
+		}
+	}
+
+	// the outermost layout first so that the {{define}} of the inner
+	// ones override its {{block}}
+	sources := make([]TemplateSource, len(chain))
+	for i, page := range chain {
+		sources[len(chain)-1-i] = page
+	}
+	set, err := a.templateEngine(chain[0].Name).Parse(sources, funcs)
+	if err != nil {
+		return nil, err
+	}
+	if cache {
+		a.TemplateMgr.CacheParsed(key, contents, set)
+	}
+	return set, nil
+}
+
+// bindTemplates returns a copy of the template set of the page and its
+// layouts bound to the funcs of the request. The layouts output the
+// body of the template they wrap with {{yield}}.
+func (c *Action) bindTemplates(chain []TemplateSource) (TemplateSet, error) {
+	var set TemplateSet
+	level := len(chain) - 1
+	c.f["yield"] = func() (template.HTML, error) {
+		if level == 0 {
+			return "", nil
+		}
+		level--
+		defer func() { level++ }()
+		var buf bytes.Buffer
+		err := set.ExecuteTemplate(&buf, chain[level].Name, c.C.Elem().Interface())
+		return template.HTML(buf.String()), err
+	}
+
+	parsed, err := c.App.parseTemplates(chain, c.parseFuncs())
+	if err != nil {
+		return nil, err
+	}
+	if set, err = parsed.Bind(template.FuncMap(c.f)); err != nil {
+		return nil, err
+	}
+	if ht, ok := set.(htmlTemplateSet); ok {
+		c.RootTemplate = ht.Template
+	}
+	return set, nil
+}
@@ -0,0 +1,142 @@
+package xweb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-xweb/log"
+)
+
+func TestDeclaredLayout(t *testing.T) {
+	tests := map[string]string{
+		`{{layout "layouts/base.html"}}<p>hi</p>`:                "layouts/base.html",
+		"{{- layout \"admin.html\" -}}\n{{define \"a\"}}{{end}}": "admin.html",
+		`<p>{{.Layout}}</p>`:                                     "",
+		`{{template "layout" .}}`:                                "",
+	}
+	for content, want := range tests {
+		if got := declaredLayout(content); got != want {
+			t.Errorf("declaredLayout(%q) = %q, want %q", content, got, want)
+		}
+	}
+}
+
+type layoutAction struct {
+	*Action
+	page    Mapper `xweb:"/page"`
+	set     Mapper `xweb:"/set"`
+	none    Mapper `xweb:"/none"`
+	plain   Mapper `xweb:"/plain"`
+	nested  Mapper `xweb:"/nested"`
+	loop    Mapper `xweb:"/loop"`
+	deep    Mapper `xweb:"/deep"`
+	missing Mapper `xweb:"/missing"`
+	User    string
+}
+
+func (a *layoutAction) Page() error {
+	a.User = "bob"
+	return a.Render("page.html")
+}
+
+func (a *layoutAction) Set() error {
+	a.User = "bob"
+	a.SetLayout("alt.html")
+	return a.Render("page.html")
+}
+
+func (a *layoutAction) None() error {
+	a.User = "bob"
+	a.SetLayout("")
+	return a.Render("page.html")
+}
+
+func (a *layoutAction) Plain() error {
+	return a.Render("plain.html")
+}
+
+func (a *layoutAction) Nested() error {
+	return a.Render("nested.html")
+}
+
+func (a *layoutAction) Loop() error {
+	return a.Render("loop.html")
+}
+
+func (a *layoutAction) Deep() error {
+	return a.Render("deep0.html")
+}
+
+func (a *layoutAction) Missing() error {
+	return a.Render("missing.html")
+}
+
+func TestRenderLayouts(t *testing.T) {
+	templates := fstest.MapFS{
+		"base.html":    {Data: []byte(`<title>{{block "title" .}}Site{{end}}</title><main>{{yield}}</main>`)},
+		"alt.html":     {Data: []byte(`<div>{{yield}}</div>`)},
+		"default.html": {Data: []byte(`<body>{{yield}}</body>`)},
+		"page.html":    {Data: []byte(`{{layout "base.html"}}{{define "title"}}Page{{end}}<p>{{.User}}</p>`)},
+		"plain.html":   {Data: []byte(`plain`)},
+		"section.html": {Data: []byte(`{{layout "base.html"}}<section>{{yield}}</section>`)},
+		"nested.html":  {Data: []byte(`{{layout "section.html"}}{{define "title"}}Nested{{end}}inner`)},
+		"loop.html":    {Data: []byte(`{{layout "loopa.html"}}loop`)},
+		"loopa.html":   {Data: []byte(`{{layout "loop.html"}}{{yield}}`)},
+		"missing.html": {Data: []byte(`{{layout "nope.html"}}missing`)},
+	}
+	for i := 0; i <= maxLayoutDepth+1; i++ {
+		name := fmt.Sprintf("deep%d.html", i)
+		templates[name] = &fstest.MapFile{Data: []byte(fmt.Sprintf(`{{layout "deep%d.html"}}{{yield}}`, i+1))}
+	}
+	templates[fmt.Sprintf("deep%d.html", maxLayoutDepth+2)] = &fstest.MapFile{Data: []byte(`{{yield}}`)}
+
+	s := NewServer("layouts")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.RootApp.AppConfig.TemplateFS = templates
+	s.RootApp.AppConfig.Layout = "default.html"
+	var reported error
+	s.RootApp.ErrorHandler = func(c *Action, err error) error {
+		reported = err
+		return err
+	}
+	s.AddAction(&layoutAction{})
+	s.initServer()
+
+	get := func(path string) (int, string) {
+		reported = nil
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code, w.Body.String()
+	}
+
+	tests := map[string]string{
+		"/page":   "<title>Page</title><main><p>bob</p></main>",
+		"/set":    "<div><p>bob</p></div>",
+		"/none":   "<p>bob</p>",
+		"/plain":  "<body>plain</body>",
+		"/nested": "<title>Nested</title><main><section>inner</section></main>",
+	}
+	for path, want := range tests {
+		if code, body := get(path); code != 200 || body != want {
+			t.Errorf("%s: got %d %q, want %q", path, code, body, want)
+		}
+	}
+
+	errors := map[string]string{
+		"/loop":    "layout loop.html of loopa.html is recursive",
+		"/deep":    "layouts of deep0.html are nested too deep",
+		"/missing": "nope.html",
+	}
+	for path, want := range errors {
+		if code, _ := get(path); code != 500 {
+			t.Errorf("%s: got %d, want 500", path, code)
+		}
+		if reported == nil || !strings.Contains(reported.Error(), want) {
+			t.Errorf("%s: got error %v, want %q", path, reported, want)
+		}
+	}
+}
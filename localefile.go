@@ -0,0 +1,352 @@
+package xweb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// message is a translated message by plural category, a message without
+// plural forms only has the other one.
+type message map[string]string
+
+// parseLocaleFile reads the messages of the locale file name in the
+// language lang, by its extension: .json, .toml or .po.
+func parseLocaleFile(lang, name string, content []byte) (map[string]message, error) {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".json":
+		var tree map[string]interface{}
+		if err := json.Unmarshal(content, &tree); err != nil {
+			return nil, fmt.Errorf("%v: %v", name, err)
+		}
+		return flattenMessages(tree)
+	case ".toml":
+		tree, err := parseToml(content)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v", name, err)
+		}
+		return flattenMessages(tree)
+	case ".po":
+		messages, err := parsePo(lang, content)
+		if err != nil {
+			return nil, fmt.Errorf("%v:%v", name, err)
+		}
+		return messages, nil
+	}
+	return nil, fmt.Errorf("%v: unknown locale file type", name)
+}
+
+// flattenMessages returns the messages of the tables of tree by their
+// dotted keys, e.g. menu.home. The tables whose keys are all plural
+// categories are the forms of a plural message.
+func flattenMessages(tree map[string]interface{}) (map[string]message, error) {
+	messages := make(map[string]message)
+	var flatten func(prefix string, table map[string]interface{}) error
+	flatten = func(prefix string, table map[string]interface{}) error {
+		for k, v := range table {
+			key := prefix + k
+			switch v := v.(type) {
+			case string:
+				messages[key] = message{PluralOther: v}
+			case map[string]interface{}:
+				if !isPluralTable(v) {
+					if err := flatten(key+".", v); err != nil {
+						return err
+					}
+					continue
+				}
+				msg := make(message, len(v))
+				for category, form := range v {
+					s, ok := form.(string)
+					if !ok {
+						return fmt.Errorf("message %v.%v is not a string", key, category)
+					}
+					msg[category] = s
+				}
+				messages[key] = msg
+			default:
+				return fmt.Errorf("message %v is not a string", key)
+			}
+		}
+		return nil
+	}
+	if err := flatten("", tree); err != nil {
+		return nil, err
+	}
+	return messages, nil
+}
+
+func isPluralTable(table map[string]interface{}) bool {
+	for k := range table {
+		if !pluralCategories[k] {
+			return false
+		}
+	}
+	return len(table) > 0
+}
+
+// parseToml parses the subset of TOML the locale files need: the
+// [tables], the dotted or quoted keys and the single line strings.
+func parseToml(content []byte) (map[string]interface{}, error) {
+	root := make(map[string]interface{})
+	table := root
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		if line[0] == '[' {
+			end := strings.LastIndex(line, "]")
+			if strings.HasPrefix(line, "[[") || end < 0 || !isTomlEnd(line[end+1:]) {
+				return nil, fmt.Errorf("%v: invalid table %v", lineNo, line)
+			}
+			keys, err := parseTomlKey(line[1:end])
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", lineNo, err)
+			}
+			if table, err = tomlTable(root, keys); err != nil {
+				return nil, fmt.Errorf("%v: %v", lineNo, err)
+			}
+			continue
+		}
+
+		eq := tomlKeyEnd(line)
+		if eq < 0 {
+			return nil, fmt.Errorf("%v: expected key = value", lineNo)
+		}
+		keys, err := parseTomlKey(line[:eq])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", lineNo, err)
+		}
+		value, rest, err := tomlString(strings.TrimSpace(line[eq+1:]))
+		if err != nil || !isTomlEnd(rest) {
+			return nil, fmt.Errorf("%v: the value of %v is not a string", lineNo, strings.Join(keys, "."))
+		}
+		parent, err := tomlTable(table, keys[:len(keys)-1])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", lineNo, err)
+		}
+		parent[keys[len(keys)-1]] = value
+	}
+	return root, scanner.Err()
+}
+
+// tomlKeyEnd returns the index of the = after the key of line.
+func tomlKeyEnd(line string) int {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '=':
+			return i
+		}
+	}
+	return -1
+}
+
+// parseTomlKey splits a dotted key, e.g. a."b.c", into its parts.
+func parseTomlKey(s string) ([]string, error) {
+	var keys []string
+	for {
+		s = strings.TrimSpace(s)
+		var key string
+		if s != "" && (s[0] == '"' || s[0] == '\'') {
+			var err error
+			if key, s, err = tomlString(s); err != nil {
+				return nil, err
+			}
+			s = strings.TrimSpace(s)
+		} else {
+			end := strings.IndexByte(s, '.')
+			if end < 0 {
+				end = len(s)
+			}
+			key, s = strings.TrimSpace(s[:end]), s[end:]
+			if key == "" {
+				return nil, fmt.Errorf("empty key")
+			}
+		}
+		keys = append(keys, key)
+		if s == "" {
+			return keys, nil
+		}
+		if s[0] != '.' {
+			return nil, fmt.Errorf("invalid key near %v", s)
+		}
+		s = s[1:]
+	}
+}
+
+// tomlString reads the basic or literal string s starts with, returning
+// what follows it.
+func tomlString(s string) (string, string, error) {
+	if s == "" || strings.HasPrefix(s, `"""`) || strings.HasPrefix(s, "'''") {
+		return "", "", fmt.Errorf("expected a single line string")
+	}
+	switch s[0] {
+	case '\'':
+		end := strings.IndexByte(s[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return s[1 : end+1], s[end+2:], nil
+	case '"':
+		for i := 1; i < len(s); i++ {
+			switch s[i] {
+			case '\\':
+				i++
+			case '"':
+				str, err := strconv.Unquote(s[:i+1])
+				return str, s[i+1:], err
+			}
+		}
+		return "", "", fmt.Errorf("unterminated string")
+	}
+	return "", "", fmt.Errorf("expected a string")
+}
+
+// isTomlEnd reports whether rest, what follows a value, is blank or a
+// comment.
+func isTomlEnd(rest string) bool {
+	rest = strings.TrimSpace(rest)
+	return rest == "" || rest[0] == '#'
+}
+
+// tomlTable returns the table of the keys under table, creating it.
+func tomlTable(table map[string]interface{}, keys []string) (map[string]interface{}, error) {
+	for i, key := range keys {
+		switch sub := table[key].(type) {
+		case nil:
+			child := make(map[string]interface{})
+			table[key] = child
+			table = child
+		case map[string]interface{}:
+			table = sub
+		default:
+			return nil, fmt.Errorf("%v is not a table", strings.Join(keys[:i+1], "."))
+		}
+	}
+	return table, nil
+}
+
+// poEntry is an entry of a gettext file being read.
+type poEntry struct {
+	msgid, msgidPlural string
+	msgstr             map[int]string
+	fuzzy              bool
+}
+
+// parsePo reads the translated entries of a gettext file, by their
+// msgid. The msgstr[n] of the plural entries are the plural categories
+// of lang in their order, e.g. one, few and many in Russian. The fuzzy
+// entries are left out, like msgfmt does, and msgctxt is ignored.
+func parsePo(lang string, content []byte) (map[string]message, error) {
+	messages := make(map[string]message)
+	categories := pluralRuleOf(lang).categories
+	var entry *poEntry
+	var fuzzy bool
+	// appendTo adds the continuation lines to the last string read
+	var appendTo func(s string)
+
+	flush := func() {
+		if entry != nil && entry.msgid != "" && !entry.fuzzy {
+			msg := make(message)
+			if entry.msgidPlural == "" {
+				if s := entry.msgstr[0]; s != "" {
+					msg[PluralOther] = s
+				}
+			} else {
+				for n, s := range entry.msgstr {
+					if s != "" && n < len(categories) {
+						msg[categories[n]] = s
+					}
+				}
+			}
+			if len(msg) > 0 {
+				messages[entry.msgid] = msg
+			}
+		}
+		entry = &poEntry{msgstr: make(map[int]string), fuzzy: fuzzy}
+		fuzzy = false
+		appendTo = nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for lineNo := 1; scanner.Scan(); lineNo++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' {
+			if strings.HasPrefix(line, "#,") && strings.Contains(line, "fuzzy") {
+				fuzzy = true
+			}
+			continue
+		}
+		if line[0] == '"' {
+			if appendTo == nil {
+				return nil, fmt.Errorf("%v: unexpected string", lineNo)
+			}
+			s, err := strconv.Unquote(line)
+			if err != nil {
+				return nil, fmt.Errorf("%v: %v", lineNo, err)
+			}
+			appendTo(s)
+			continue
+		}
+
+		keyword, value := line, ""
+		if i := strings.IndexAny(line, " \t"); i > 0 {
+			keyword, value = line[:i], strings.TrimSpace(line[i:])
+		}
+		s, err := strconv.Unquote(value)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", lineNo, err)
+		}
+		switch {
+		case keyword == "msgctxt":
+			flush()
+			appendTo = func(string) {}
+		case keyword == "msgid":
+			if entry == nil || entry.msgid != "" || len(entry.msgstr) > 0 {
+				flush()
+			}
+			e := entry
+			e.msgid = s
+			appendTo = func(s string) { e.msgid += s }
+		case keyword == "msgid_plural" && entry != nil:
+			e := entry
+			e.msgidPlural = s
+			appendTo = func(s string) { e.msgidPlural += s }
+		case strings.HasPrefix(keyword, "msgstr") && entry != nil:
+			n := 0
+			if index := keyword[len("msgstr"):]; index != "" {
+				if !strings.HasPrefix(index, "[") || !strings.HasSuffix(index, "]") {
+					return nil, fmt.Errorf("%v: unknown keyword %v", lineNo, keyword)
+				}
+				if n, err = strconv.Atoi(index[1 : len(index)-1]); err != nil {
+					return nil, fmt.Errorf("%v: invalid %v", lineNo, keyword)
+				}
+			}
+			e := entry
+			e.msgstr[n] = s
+			appendTo = func(s string) { e.msgstr[n] += s }
+		default:
+			return nil, fmt.Errorf("%v: unexpected %v", lineNo, keyword)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	flush()
+	return messages, nil
+}
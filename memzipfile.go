@@ -1,26 +1,83 @@
 package xweb
 
 import (
-	"bytes"
 	"compress/flate"
 	"compress/gzip"
+	"container/list"
 	"errors"
 	"io"
+	"io/fs"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"strings"
+	"path/filepath"
 	"sync"
 	"time"
+
+	"github.com/andybalholm/brotli"
+	"github.com/klauspost/compress/zstd"
 )
 
-var gmfim map[string]*MemFileInfo = make(map[string]*MemFileInfo)
-var lock sync.RWMutex
+// MemZipCacheSize bounds the memory used by the static files compressed
+// by OpenMemZipFile, the least recently served ones being evicted.
+var MemZipCacheSize int64 = 32 << 20
+
+var gmfim = &memFileCache{lru: list.New(), items: make(map[string]*list.Element)}
+var lock sync.Mutex
+
+// memFileCache is a LRU cache of compressed files, it must be used
+// with lock held.
+type memFileCache struct {
+	lru   *list.List
+	items map[string]*list.Element
+	size  int64
+}
+
+type memFileCacheItem struct {
+	key string
+	fi  *MemFileInfo
+}
+
+func (c *memFileCache) get(key string) (*MemFileInfo, bool) {
+	el, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	return el.Value.(*memFileCacheItem).fi, true
+}
+
+func (c *memFileCache) set(key string, fi *MemFileInfo) {
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	if MemZipCacheSize > 0 && fi.contentSize > MemZipCacheSize {
+		return
+	}
+	c.items[key] = c.lru.PushFront(&memFileCacheItem{key, fi})
+	c.size += fi.contentSize
+	for MemZipCacheSize > 0 && c.size > MemZipCacheSize {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *memFileCache) remove(el *list.Element) {
+	item := c.lru.Remove(el).(*memFileCacheItem)
+	delete(c.items, item.key)
+	c.size -= item.fi.contentSize
+}
 
 // OpenMemZipFile returns MemFile object with a compressed static file.
 // it's used for serve static file if gzip enable.
+// zip is one of br, zstd, gzip and deflate, or empty for the raw content.
 func OpenMemZipFile(path string, zip string) (*MemFile, error) {
-	osfile, e := os.Open(path)
+	return openMemZipFile(DiskFS(filepath.Dir(path)), filepath.Base(path), path, zip)
+}
+
+// openMemZipFile compresses the file name of fsys, key identifying it
+// in the cache.
+func openMemZipFile(fsys fs.FS, name string, key string, zip string) (*MemFile, error) {
+	osfile, e := fsys.Open(name)
 	if e != nil {
 		return nil, e
 	}
@@ -33,48 +90,18 @@ func OpenMemZipFile(path string, zip string) (*MemFile, error) {
 
 	modtime := osfileinfo.ModTime()
 	fileSize := osfileinfo.Size()
-	lock.RLock()
-	cfi, ok := gmfim[zip+":"+path]
-	lock.RUnlock()
+	lock.Lock()
+	cfi, ok := gmfim.get(zip + ":" + key)
+	lock.Unlock()
 	if ok && cfi.ModTime() == modtime && cfi.fileSize == fileSize {
 	} else {
-		var content []byte
-		if zip == "gzip" {
-			//将文件内容压缩到zipbuf中
-			var zipbuf bytes.Buffer
-			gzipwriter, e := gzip.NewWriterLevel(&zipbuf, gzip.BestCompression)
-			if e != nil {
-				return nil, e
-			}
-			_, e = io.Copy(gzipwriter, osfile)
-			gzipwriter.Close()
-			if e != nil {
-				return nil, e
-			}
-			//读zipbuf到content
-			content, e = ioutil.ReadAll(&zipbuf)
-			if e != nil {
-				return nil, e
-			}
-		} else if zip == "deflate" {
-			//将文件内容压缩到zipbuf中
-			var zipbuf bytes.Buffer
-			deflatewriter, e := flate.NewWriter(&zipbuf, flate.BestCompression)
-			if e != nil {
-				return nil, e
-			}
-			_, e = io.Copy(deflatewriter, osfile)
-			deflatewriter.Close()
-			if e != nil {
-				return nil, e
-			}
-			//将zipbuf读入到content
-			content, e = ioutil.ReadAll(&zipbuf)
-			if e != nil {
-				return nil, e
-			}
-		} else {
-			content, e = ioutil.ReadAll(osfile)
+		content, e := ioutil.ReadAll(osfile)
+		if e != nil {
+			return nil, e
+		}
+		if zip != "" {
+			//将文件内容压缩到content
+			content, e = compressBytes(content, zip, true)
 			if e != nil {
 				return nil, e
 			}
@@ -83,7 +110,7 @@ func OpenMemZipFile(path string, zip string) (*MemFile, error) {
 		cfi = &MemFileInfo{osfileinfo, modtime, content, int64(len(content)), fileSize}
 		lock.Lock()
 		defer lock.Unlock()
-		gmfim[zip+":"+path] = cfi
+		gmfim.set(zip+":"+key, cfi)
 	}
 	return &MemFile{fi: cfi, offset: 0}, nil
 }
@@ -188,19 +215,11 @@ func (f *MemFile) Seek(offset int64, whence int) (ret int64, err error) {
 }
 
 // GetAcceptEncodingZip returns accept encoding format in http header.
-// zip is first, then deflate if both accepted.
+// br, zstd, gzip then deflate are preferred when accepted with the same
+// quality value.
 // If no accepted, return empty string.
 func GetAcceptEncodingZip(r *http.Request) string {
-	ss := r.Header.Get("Accept-Encoding")
-	ss = strings.ToLower(ss)
-	if strings.Contains(ss, "gzip") {
-		return "gzip"
-	} else if strings.Contains(ss, "deflate") {
-		return "deflate"
-	} else {
-		return ""
-	}
-	return ""
+	return negotiateEncoding(r.Header.Get("Accept-Encoding"), defaultCompressEncodings)
 }
 
 // CloseZWriter closes the io.Writer after compressing static file.
@@ -214,6 +233,10 @@ func CloseZWriter(zwriter io.Writer) {
 		zwriter.(*gzip.Writer).Close()
 	case *flate.Writer:
 		zwriter.(*flate.Writer).Close()
+	case *brotli.Writer:
+		zwriter.(*brotli.Writer).Close()
+	case *zstd.Encoder:
+		zwriter.(*zstd.Encoder).Close()
 		//其他情况不close, 保持和默认(非压缩)行为一致
 		/*
 			case io.WriteCloser:
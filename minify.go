@@ -0,0 +1,354 @@
+package xweb
+
+import (
+	"bytes"
+	"strings"
+)
+
+func isMinifySpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func lastByte(buf *bytes.Buffer) byte {
+	if buf.Len() == 0 {
+		return 0
+	}
+	return buf.Bytes()[buf.Len()-1]
+}
+
+// copyQuoted copies the string literal of src starting at i, returning
+// the index of its closing quote.
+func copyQuoted(out *bytes.Buffer, src []byte, i int) int {
+	quote := src[i]
+	out.WriteByte(quote)
+	for i++; i < len(src); i++ {
+		out.WriteByte(src[i])
+		if src[i] == '\\' && i+1 < len(src) {
+			i++
+			out.WriteByte(src[i])
+		} else if src[i] == quote {
+			break
+		}
+	}
+	return i
+}
+
+// MinifyCSS removes the comments and the needless whitespace of a
+// style sheet.
+func MinifyCSS(src []byte) []byte {
+	var out bytes.Buffer
+	space := false
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				i = len(src)
+			} else {
+				i += end + 3
+			}
+			space = true
+			continue
+		case isMinifySpace(c):
+			space = true
+			continue
+		}
+
+		if space && out.Len() > 0 {
+			// the spaces before ":" or "(" may be meaningful, as in
+			// "a :hover" or "and (max-width: 100px)".
+			if !strings.ContainsRune("{};,>~(:", rune(lastByte(&out))) && !strings.ContainsRune("{};,>~)", rune(c)) {
+				out.WriteByte(' ')
+			}
+		}
+		space = false
+		if c == '}' && lastByte(&out) == ';' {
+			out.Truncate(out.Len() - 1)
+		}
+		if c == '"' || c == '\'' {
+			i = copyQuoted(&out, src, i)
+		} else {
+			out.WriteByte(c)
+		}
+	}
+	return out.Bytes()
+}
+
+// copyTemplateLiteral copies the template literal of src starting at i,
+// with the ${ } substitutions and the literals nested in them, returning
+// the index of its closing backquote.
+func copyTemplateLiteral(out *bytes.Buffer, src []byte, i int) int {
+	out.WriteByte('`')
+	for i++; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '\\' && i+1 < len(src):
+			out.WriteByte(c)
+			i++
+			out.WriteByte(src[i])
+		case c == '`':
+			out.WriteByte(c)
+			return i
+		case c == '$' && i+1 < len(src) && src[i+1] == '{':
+			out.WriteString("${")
+			i = copySubstitution(out, src, i+2)
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return i
+}
+
+// copySubstitution copies as is the expression of a ${ } substitution
+// starting at i, returning the index of its closing brace.
+func copySubstitution(out *bytes.Buffer, src []byte, i int) int {
+	depth := 0
+	for ; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '"' || c == '\'':
+			i = copyQuoted(out, src, i)
+			continue
+		case c == '`':
+			i = copyTemplateLiteral(out, src, i)
+			continue
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth == 0 {
+				out.WriteByte(c)
+				return i
+			}
+			depth--
+		}
+		out.WriteByte(c)
+	}
+	return i
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || c == '$' || c == '\\' || c >= 0x80 ||
+		c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// regexpAllowed reports whether a slash following the minified output
+// starts a regular expression rather than a division.
+func regexpAllowed(out *bytes.Buffer) bool {
+	b := bytes.TrimRight(out.Bytes(), " \n")
+	if len(b) == 0 {
+		return true
+	}
+	if strings.ContainsRune("(,=:[!&|?{};+-*%<>~^", rune(b[len(b)-1])) {
+		return true
+	}
+	for _, keyword := range []string{"return", "typeof", "case", "do", "else", "in", "of", "void", "delete", "throw", "new"} {
+		if bytes.HasSuffix(b, []byte(keyword)) {
+			n := len(b) - len(keyword)
+			if n == 0 || !isIdentByte(b[n-1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MinifyJS removes the comments and the needless whitespace of a
+// script. It keeps the line breaks on which automatic semicolon
+// insertion may depend, and the /*! license */ comments.
+func MinifyJS(src []byte) []byte {
+	var out bytes.Buffer
+	space, newline := false, false
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case c == '/' && i+1 < len(src) && src[i+1] == '/':
+			for i < len(src) && src[i] != '\n' {
+				i++
+			}
+			newline = true
+			continue
+		case c == '/' && i+1 < len(src) && src[i+1] == '*':
+			end := bytes.Index(src[i+2:], []byte("*/"))
+			if end < 0 {
+				end = len(src) - i - 2
+			}
+			comment := src[i : i+2+end]
+			if i+2 < len(src) && src[i+2] == '!' {
+				out.Write(comment)
+				out.WriteString("*/\n")
+			} else if bytes.ContainsRune(comment, '\n') {
+				newline = true
+			} else {
+				space = true
+			}
+			i += end + 3
+			continue
+		case c == '\n' || c == '\r':
+			newline = true
+			continue
+		case isMinifySpace(c):
+			space = true
+			continue
+		}
+
+		if (space || newline) && out.Len() > 0 {
+			prev := lastByte(&out)
+			if newline && !strings.ContainsRune("{([,;\n", rune(prev)) && !strings.ContainsRune(")]},;", rune(c)) {
+				out.WriteByte('\n')
+			} else if !newline || prev != '\n' {
+				// a space is needed between identifiers and between the
+				// operators which would merge, like "a - -b" or "1 .x"
+				const safe = "{}()[];,=:<>?!&|*%^~"
+				if !strings.ContainsRune(safe, rune(prev)) && !strings.ContainsRune(safe, rune(c)) {
+					out.WriteByte(' ')
+				}
+			}
+		}
+		space, newline = false, false
+
+		switch {
+		case c == '"' || c == '\'':
+			i = copyQuoted(&out, src, i)
+		case c == '`':
+			i = copyTemplateLiteral(&out, src, i)
+		case c == '/' && regexpAllowed(&out):
+			inClass := false
+			out.WriteByte(c)
+			for i++; i < len(src) && src[i] != '\n'; i++ {
+				out.WriteByte(src[i])
+				if src[i] == '\\' && i+1 < len(src) {
+					i++
+					out.WriteByte(src[i])
+				} else if src[i] == '[' {
+					inClass = true
+				} else if src[i] == ']' {
+					inClass = false
+				} else if src[i] == '/' && !inClass {
+					break
+				}
+			}
+		default:
+			out.WriteByte(c)
+		}
+	}
+	return bytes.TrimSpace(out.Bytes())
+}
+
+// rawHTMLElements keep their content as is.
+var rawHTMLElements = []string{"pre", "textarea", "script", "style"}
+
+// hasPrefixFold reports whether b begins with the lower case ASCII
+// prefix, ignoring the ASCII case of b. Unlike bytes.ToLower, it keeps
+// the indexes of b.
+func hasPrefixFold(b []byte, prefix string) bool {
+	if len(b) < len(prefix) {
+		return false
+	}
+	for i := 0; i < len(prefix); i++ {
+		c := b[i]
+		if c >= 'A' && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		if c != prefix[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// indexFold returns the index of the lower case ASCII s in b, ignoring
+// the ASCII case of b, or -1.
+func indexFold(b []byte, s string) int {
+	for i := 0; i+len(s) <= len(b); i++ {
+		if hasPrefixFold(b[i:], s) {
+			return i
+		}
+	}
+	return -1
+}
+
+// MinifyHTML removes the comments of a page, but the conditional ones,
+// and collapses its whitespace, except in the pre, textarea, script
+// and style elements, in the quoted attribute values and in the {{ }}
+// template actions.
+func MinifyHTML(src []byte) []byte {
+	var out bytes.Buffer
+	space, inTag := false, false
+	var quote byte
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		if bytes.HasPrefix(src[i:], []byte("{{")) {
+			if space {
+				out.WriteByte(' ')
+				space = false
+			}
+			end := bytes.Index(src[i+2:], []byte("}}"))
+			if end < 0 {
+				out.Write(src[i:])
+				break
+			}
+			out.Write(src[i : i+end+4])
+			i += end + 3
+			continue
+		}
+		if quote != 0 {
+			out.WriteByte(c)
+			if c == quote {
+				quote = 0
+			}
+			continue
+		}
+		if isMinifySpace(c) {
+			space = true
+			continue
+		}
+		if !inTag && bytes.HasPrefix(src[i:], []byte("<!--")) &&
+			!bytes.HasPrefix(src[i:], []byte("<!--[if")) && !bytes.HasPrefix(src[i:], []byte("<!--!")) {
+			end := bytes.Index(src[i+4:], []byte("-->"))
+			if end < 0 {
+				break
+			}
+			i += end + 6
+			continue
+		}
+		if space {
+			out.WriteByte(' ')
+			space = false
+		}
+
+		if inTag {
+			if c == '"' || c == '\'' {
+				quote = c
+			} else if c == '>' {
+				inTag = false
+			}
+			out.WriteByte(c)
+			continue
+		}
+		if c == '<' {
+			raw := false
+			for _, name := range rawHTMLElements {
+				if hasPrefixFold(src[i+1:], name) && i+1+len(name) < len(src) &&
+					!isIdentByte(src[i+1+len(name)]) {
+					end := indexFold(src[i:], "</"+name)
+					if end < 0 {
+						end = len(src) - i
+					}
+					out.Write(src[i : i+end])
+					i += end - 1
+					raw = true
+					break
+				}
+			}
+			if raw {
+				continue
+			}
+			if i+1 < len(src) && (src[i+1] == '/' || src[i+1] == '!' || isIdentByte(src[i+1])) {
+				inTag = true
+			}
+		}
+		out.WriteByte(c)
+	}
+	return bytes.TrimSpace(out.Bytes())
+}
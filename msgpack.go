@@ -0,0 +1,235 @@
+package xweb
+
+import (
+	"encoding"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// msgpackMarshal returns the MessagePack encoding of v. Structs are
+// encoded as maps keyed by the field name, or by the name given in a
+// msgpack or json tag; fields tagged "-" are skipped.
+func msgpackMarshal(v interface{}) ([]byte, error) {
+	e := &msgpackEncoder{}
+	if err := e.encode(reflect.ValueOf(v)); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
+
+// msgpackEncode writes the MessagePack encoding of v to w.
+func msgpackEncode(w io.Writer, v interface{}) error {
+	content, err := msgpackMarshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(content)
+	return err
+}
+
+type msgpackEncoder struct {
+	buf []byte
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+func (e *msgpackEncoder) writeUint(prefix byte, n uint64, size int) {
+	e.buf = append(e.buf, prefix)
+	var b [8]byte
+	binary.BigEndian.PutUint64(b[:], n)
+	e.buf = append(e.buf, b[8-size:]...)
+}
+
+func (e *msgpackEncoder) encodeInt(n int64) {
+	switch {
+	case n >= 0:
+		e.encodeUint(uint64(n))
+	case n >= -32:
+		e.buf = append(e.buf, byte(n))
+	case n >= math.MinInt8:
+		e.writeUint(0xd0, uint64(uint8(n)), 1)
+	case n >= math.MinInt16:
+		e.writeUint(0xd1, uint64(uint16(n)), 2)
+	case n >= math.MinInt32:
+		e.writeUint(0xd2, uint64(uint32(n)), 4)
+	default:
+		e.writeUint(0xd3, uint64(n), 8)
+	}
+}
+
+func (e *msgpackEncoder) encodeUint(n uint64) {
+	switch {
+	case n <= 0x7f:
+		e.buf = append(e.buf, byte(n))
+	case n <= math.MaxUint8:
+		e.writeUint(0xcc, n, 1)
+	case n <= math.MaxUint16:
+		e.writeUint(0xcd, n, 2)
+	case n <= math.MaxUint32:
+		e.writeUint(0xce, n, 4)
+	default:
+		e.writeUint(0xcf, n, 8)
+	}
+}
+
+func (e *msgpackEncoder) encodeString(s string) {
+	n := len(s)
+	switch {
+	case n <= 31:
+		e.buf = append(e.buf, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		e.writeUint(0xd9, uint64(n), 1)
+	case n <= math.MaxUint16:
+		e.writeUint(0xda, uint64(n), 2)
+	default:
+		e.writeUint(0xdb, uint64(n), 4)
+	}
+	e.buf = append(e.buf, s...)
+}
+
+func (e *msgpackEncoder) encodeBytes(b []byte) {
+	n := len(b)
+	switch {
+	case n <= math.MaxUint8:
+		e.writeUint(0xc4, uint64(n), 1)
+	case n <= math.MaxUint16:
+		e.writeUint(0xc5, uint64(n), 2)
+	default:
+		e.writeUint(0xc6, uint64(n), 4)
+	}
+	e.buf = append(e.buf, b...)
+}
+
+func (e *msgpackEncoder) encodeLen(fix, b16, b32 byte, n int) {
+	switch {
+	case n <= 15:
+		e.buf = append(e.buf, fix|byte(n))
+	case n <= math.MaxUint16:
+		e.writeUint(b16, uint64(n), 2)
+	default:
+		e.writeUint(b32, uint64(n), 4)
+	}
+}
+
+func msgpackFieldName(f reflect.StructField) (string, bool) {
+	tag := f.Tag.Get("msgpack")
+	if tag == "" {
+		tag = f.Tag.Get("json")
+	}
+	name := strings.Split(tag, ",")[0]
+	if name == "-" {
+		return "", false
+	}
+	if name == "" {
+		name = f.Name
+	}
+	return name, true
+}
+
+func (e *msgpackEncoder) encode(v reflect.Value) error {
+	if !v.IsValid() {
+		e.buf = append(e.buf, 0xc0)
+		return nil
+	}
+
+	if v.Type() == timeType {
+		e.encodeString(v.Interface().(time.Time).Format(time.RFC3339Nano))
+		return nil
+	}
+	if v.Kind() != reflect.Ptr && v.Kind() != reflect.Interface && v.Type().Implements(textMarshalerType) {
+		text, err := v.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		e.encodeString(string(text))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		return e.encode(v.Elem())
+	case reflect.Bool:
+		if v.Bool() {
+			e.buf = append(e.buf, 0xc3)
+		} else {
+			e.buf = append(e.buf, 0xc2)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		e.encodeInt(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		e.encodeUint(v.Uint())
+	case reflect.Float32:
+		e.writeUint(0xca, uint64(math.Float32bits(float32(v.Float()))), 4)
+	case reflect.Float64:
+		e.writeUint(0xcb, math.Float64bits(v.Float()), 8)
+	case reflect.String:
+		e.encodeString(v.String())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			b := make([]byte, v.Len())
+			reflect.Copy(reflect.ValueOf(b), v)
+			e.encodeBytes(b)
+			return nil
+		}
+		e.encodeLen(0x90, 0xdc, 0xdd, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if err := e.encode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Map:
+		if v.IsNil() {
+			e.buf = append(e.buf, 0xc0)
+			return nil
+		}
+		e.encodeLen(0x80, 0xde, 0xdf, v.Len())
+		for _, key := range v.MapKeys() {
+			if err := e.encode(key); err != nil {
+				return err
+			}
+			if err := e.encode(v.MapIndex(key)); err != nil {
+				return err
+			}
+		}
+	case reflect.Struct:
+		t := v.Type()
+		var fields []int
+		var names []string
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			if f.PkgPath != "" {
+				continue
+			}
+			if name, ok := msgpackFieldName(f); ok {
+				fields = append(fields, i)
+				names = append(names, name)
+			}
+		}
+		e.encodeLen(0x80, 0xde, 0xdf, len(fields))
+		for i, idx := range fields {
+			e.encodeString(names[i])
+			if err := e.encode(v.Field(idx)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("msgpack: unsupported type %v", v.Type())
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package xweb
+
+import "strings"
+
+// The plural categories of the messages, from the CLDR.
+const (
+	PluralZero  = "zero"
+	PluralOne   = "one"
+	PluralTwo   = "two"
+	PluralFew   = "few"
+	PluralMany  = "many"
+	PluralOther = "other"
+)
+
+var pluralCategories = map[string]bool{
+	PluralZero: true, PluralOne: true, PluralTwo: true,
+	PluralFew: true, PluralMany: true, PluralOther: true,
+}
+
+// pluralRule gives the plural category of a count in a language. Its
+// categories are in the order of the msgstr[n] of the gettext files.
+type pluralRule struct {
+	categories []string
+	category   func(n int64) string
+}
+
+func slavicFew(n int64) bool {
+	return n%10 >= 2 && n%10 <= 4 && (n%100 < 12 || n%100 > 14)
+}
+
+var (
+	noPlural = &pluralRule{
+		[]string{PluralOther},
+		func(n int64) string { return PluralOther },
+	}
+	oneOtherPlural = &pluralRule{
+		[]string{PluralOne, PluralOther},
+		func(n int64) string {
+			if n == 1 {
+				return PluralOne
+			}
+			return PluralOther
+		},
+	}
+	// zero counts as one, e.g. in French
+	zeroOnePlural = &pluralRule{
+		[]string{PluralOne, PluralOther},
+		func(n int64) string {
+			if n == 0 || n == 1 {
+				return PluralOne
+			}
+			return PluralOther
+		},
+	}
+	eastSlavicPlural = &pluralRule{
+		[]string{PluralOne, PluralFew, PluralMany},
+		func(n int64) string {
+			switch {
+			case n%10 == 1 && n%100 != 11:
+				return PluralOne
+			case slavicFew(n):
+				return PluralFew
+			}
+			return PluralMany
+		},
+	}
+	polishPlural = &pluralRule{
+		[]string{PluralOne, PluralFew, PluralMany},
+		func(n int64) string {
+			switch {
+			case n == 1:
+				return PluralOne
+			case slavicFew(n):
+				return PluralFew
+			}
+			return PluralMany
+		},
+	}
+	czechPlural = &pluralRule{
+		[]string{PluralOne, PluralFew, PluralOther},
+		func(n int64) string {
+			switch {
+			case n == 1:
+				return PluralOne
+			case n >= 2 && n <= 4:
+				return PluralFew
+			}
+			return PluralOther
+		},
+	}
+	arabicPlural = &pluralRule{
+		[]string{PluralZero, PluralOne, PluralTwo, PluralFew, PluralMany, PluralOther},
+		func(n int64) string {
+			switch {
+			case n == 0:
+				return PluralZero
+			case n == 1:
+				return PluralOne
+			case n == 2:
+				return PluralTwo
+			case n%100 >= 3 && n%100 <= 10:
+				return PluralFew
+			case n%100 >= 11:
+				return PluralMany
+			}
+			return PluralOther
+		},
+	}
+)
+
+// pluralRules are the rules of the languages not following the English
+// one.
+var pluralRules = map[string]*pluralRule{
+	"zh": noPlural, "ja": noPlural, "ko": noPlural, "vi": noPlural,
+	"th": noPlural, "id": noPlural, "ms": noPlural,
+	"fr": zeroOnePlural, "pt": zeroOnePlural, "hi": zeroOnePlural,
+	"ru": eastSlavicPlural, "uk": eastSlavicPlural, "be": eastSlavicPlural,
+	"sr": eastSlavicPlural, "hr": eastSlavicPlural, "bs": eastSlavicPlural,
+	"pl": polishPlural,
+	"cs": czechPlural, "sk": czechPlural,
+	"ar": arabicPlural,
+}
+
+// pluralRuleOf returns the plural rule of the language lang.
+func pluralRuleOf(lang string) *pluralRule {
+	base := strings.ToLower(lang)
+	if i := strings.IndexAny(base, "-_"); i >= 0 {
+		base = base[:i]
+	}
+	if rule, ok := pluralRules[base]; ok {
+		return rule
+	}
+	return oneOtherPlural
+}
+
+// PluralCategory returns the plural category of the count n in the
+// language lang, e.g. "few" for 3 in Russian.
+func PluralCategory(lang string, n int64) string {
+	if n < 0 {
+		n = -n
+	}
+	return pluralRuleOf(lang).category(n)
+}
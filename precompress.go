@@ -0,0 +1,165 @@
+package xweb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// precompressedExts are the extensions of the precompressed siblings of
+// a static file, e.g. app.js.br, per content coding.
+var precompressedExts = map[string]string{
+	"br":   ".br",
+	"zstd": ".zst",
+	"gzip": ".gz",
+}
+
+func isPrecompressed(name string) bool {
+	ext := filepath.Ext(name)
+	for _, e := range precompressedExts {
+		if ext == e {
+			return true
+		}
+	}
+	return false
+}
+
+func hasExtension(name string, extensions []string) bool {
+	name = strings.ToLower(name)
+	for _, ext := range extensions {
+		if strings.HasSuffix(name, strings.ToLower(ext)) {
+			return true
+		}
+	}
+	return false
+}
+
+// PrecompressDir writes a compressed sibling per encoding, e.g.
+// app.js.br and app.js.gz, of the files of dir having one of the
+// extensions, or of all the files if extensions is empty. Up to date
+// siblings are kept and so are the files compression doesn't shrink.
+// The encodings default to br and gzip. It returns the number of files
+// written.
+func PrecompressDir(dir string, extensions []string, encodings ...string) (int, error) {
+	if len(encodings) == 0 {
+		encodings = []string{"br", "gzip"}
+	}
+	for _, encoding := range encodings {
+		if _, ok := precompressedExts[encoding]; !ok {
+			return 0, fmt.Errorf("cannot precompress with %q", encoding)
+		}
+	}
+
+	var count int
+	err := filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || isPrecompressed(p) {
+			return nil
+		}
+		if len(extensions) > 0 && !hasExtension(p, extensions) {
+			return nil
+		}
+
+		var content []byte
+		for _, encoding := range encodings {
+			target := p + precompressedExts[encoding]
+			if zinfo, err := os.Stat(target); err == nil && !zinfo.ModTime().Before(info.ModTime()) {
+				continue
+			}
+			if content == nil {
+				if content, err = ioutil.ReadFile(p); err != nil {
+					return err
+				}
+			}
+			compressed, err := compressBytes(content, encoding, true)
+			if err != nil {
+				return err
+			}
+			if len(compressed) >= len(content) {
+				continue
+			}
+			if err = ioutil.WriteFile(target, compressed, info.Mode().Perm()); err != nil {
+				return err
+			}
+			count++
+		}
+		return nil
+	})
+	return count, err
+}
+
+// Precompress writes the compressed siblings of the static files
+// matching ServerConfig.StaticExtensionsToGzip, for the encodings
+// offered by the server. It's done at startup when
+// AppConfig.PrecompressStatic is set, or may be called by a build step.
+func (a *App) Precompress() (int, error) {
+	var encodings []string
+	for _, encoding := range a.Server.compressEncodings() {
+		if _, ok := precompressedExts[encoding]; ok {
+			encodings = append(encodings, encoding)
+		}
+	}
+	dir, ok := isDiskFS(a.staticFS())
+	if !ok {
+		return 0, errors.New("the static files are not on the disk")
+	}
+	if len(encodings) == 0 {
+		return 0, nil
+	}
+	return PrecompressDir(dir, a.Server.Config.StaticExtensionsToGzip, encodings...)
+}
+
+// servePrecompressed serves the precompressed sibling of the static file
+// name of fsys preferred by the client, if one is up to date.
+func (a *App) servePrecompressed(fsys fs.FS, name string, finfo fs.FileInfo, req *http.Request, w http.ResponseWriter) bool {
+	for _, encoding := range acceptedEncodings(req.Header.Get("Accept-Encoding"), a.Server.compressEncodings()) {
+		ext, ok := precompressedExts[encoding]
+		if !ok {
+			continue
+		}
+		f, err := fsys.Open(name + ext)
+		if err != nil {
+			continue
+		}
+		zinfo, err := f.Stat()
+		if err != nil || zinfo.IsDir() || zinfo.ModTime().Before(finfo.ModTime()) {
+			f.Close()
+			continue
+		}
+		defer f.Close()
+		rs, ok := f.(io.ReadSeeker)
+		if !ok {
+			content, err := ioutil.ReadAll(f)
+			if err != nil {
+				return false
+			}
+			rs = bytes.NewReader(content)
+		}
+
+		h := w.Header()
+		addVary(h, "Accept-Encoding")
+		if h.Get("Content-Type") == "" {
+			ctype := mime.TypeByExtension(path.Ext(name))
+			if ctype == "" {
+				// never sniff the compressed content
+				ctype = "application/octet-stream"
+			}
+			h.Set("Content-Type", ctype)
+		}
+		h.Set("Content-Encoding", encoding)
+		http.ServeContent(w, req, name, finfo.ModTime(), rs)
+		return true
+	}
+	return false
+}
@@ -0,0 +1,57 @@
+package xweb
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPrecompressDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "xwebstatic")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	js := strings.Repeat("console.log('precompressed');\n", 100)
+	ioutil.WriteFile(filepath.Join(dir, "app.js"), []byte(js), 0644)
+	ioutil.WriteFile(filepath.Join(dir, "logo.png"), []byte(js), 0644)
+
+	n, err := PrecompressDir(dir, []string{".js"}, "gzip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("expected 1 file written, got %d", n)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "app.js.gz")); err != nil {
+		t.Error(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "logo.png.gz")); err == nil {
+		t.Error("files without a listed extension should not be compressed")
+	}
+	if n, _ = PrecompressDir(dir, []string{".js"}, "gzip"); n != 0 {
+		t.Errorf("up to date files were compressed again")
+	}
+	if _, err = PrecompressDir(dir, nil, "deflate"); err == nil {
+		t.Error("deflate has no precompressed file extension")
+	}
+}
+
+func TestMemFileCacheEviction(t *testing.T) {
+	defer func(size int64) { MemZipCacheSize = size }(MemZipCacheSize)
+	MemZipCacheSize = 20
+	c := &memFileCache{lru: list.New(), items: make(map[string]*list.Element)}
+	c.set("a", &MemFileInfo{contentSize: 10})
+	c.set("b", &MemFileInfo{contentSize: 10})
+	c.get("a")
+	c.set("c", &MemFileInfo{contentSize: 10})
+	if _, ok := c.get("b"); ok {
+		t.Error("the least recently used file should be evicted")
+	}
+	if _, ok := c.get("a"); !ok || c.size != 20 {
+		t.Errorf("unexpected cache state, size %d", c.size)
+	}
+}
@@ -0,0 +1,82 @@
+package xweb
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-xweb/log"
+)
+
+type renderAction struct {
+	*Action
+	page Mapper `xweb:"/page"`
+	User string
+}
+
+func (a *renderAction) Page() error {
+	a.SetSession("user", a.GetString("user"))
+	return a.Render("page.html")
+}
+
+// TestConcurrentRender renders the pages of distinct sessions at once,
+// run it with -race.
+func TestConcurrentRender(t *testing.T) {
+	s := NewServer("render")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.RootApp.AppConfig.TemplateFS = fstest.MapFS{
+		"layout.html": {Data: []byte(`<main>{{yield}}</main>`)},
+		"page.html":   {Data: []byte(`{{layout "layout.html"}}{{session "user"}}|{{include "part.html"}}`)},
+		"part.html":   {Data: []byte(`{{session "user"}}`)},
+	}
+	s.AddAction(&renderAction{})
+	s.initServer()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				user := fmt.Sprintf("user%d-%d", i, j)
+				resp, err := http.Get(srv.URL + "/page?user=" + user)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				body, _ := ioutil.ReadAll(resp.Body)
+				resp.Body.Close()
+				if want := "<main>" + user + "|" + user + "</main>"; string(body) != want {
+					t.Errorf("got %q, want %q", body, want)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestGetFuncsIsolated(t *testing.T) {
+	app := NewApp("/", "funcs")
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			c := &Action{App: app, f: T{}}
+			c.AddTmplVar("who", func() int { return i })
+			if who := c.GetFuncs()["who"].(func() int)(); who != i {
+				t.Errorf("got the func of request %d, want %d", who, i)
+			}
+		}(i)
+	}
+	wg.Wait()
+	if _, ok := app.FuncMaps["who"]; ok {
+		t.Error("the funcs of a request leaked into the App")
+	}
+}
@@ -0,0 +1,263 @@
+package xweb
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Encoder serializes the value given to Action.Respond for a media type.
+type Encoder interface {
+	Encode(w io.Writer, obj interface{}) error
+}
+
+// EncoderFunc adapts an ordinary function to the Encoder interface.
+type EncoderFunc func(w io.Writer, obj interface{}) error
+
+func (f EncoderFunc) Encode(w io.Writer, obj interface{}) error {
+	return f(w, obj)
+}
+
+type mediaEncoder struct {
+	mediaType string
+	encoder   Encoder
+}
+
+// defaultEncoders are the encoders every App starts with, in order of
+// preference when the client accepts several of them equally.
+func defaultEncoders() []mediaEncoder {
+	return []mediaEncoder{
+		{"application/json", EncoderFunc(func(w io.Writer, obj interface{}) error {
+			return json.NewEncoder(w).Encode(obj)
+		})},
+		{"application/xml", EncoderFunc(func(w io.Writer, obj interface{}) error {
+			return xml.NewEncoder(w).Encode(obj)
+		})},
+		{"text/xml", EncoderFunc(func(w io.Writer, obj interface{}) error {
+			return xml.NewEncoder(w).Encode(obj)
+		})},
+		{"text/plain", EncoderFunc(func(w io.Writer, obj interface{}) error {
+			_, err := fmt.Fprint(w, obj)
+			return err
+		})},
+		{"application/msgpack", EncoderFunc(msgpackEncode)},
+		{"application/x-msgpack", EncoderFunc(msgpackEncode)},
+		{"text/csv", EncoderFunc(csvEncode)},
+	}
+}
+
+// AddEncoder registers the encoder used by Action.Respond for
+// mediaType, replacing the existing one if any.
+func (app *App) AddEncoder(mediaType string, enc Encoder) {
+	mediaType = strings.ToLower(mediaType)
+	for i, me := range app.encoders {
+		if me.mediaType == mediaType {
+			app.encoders[i].encoder = enc
+			return
+		}
+	}
+	app.encoders = append(app.encoders, mediaEncoder{mediaType, enc})
+}
+
+// RemoveEncoder stops offering mediaType in Action.Respond.
+func (app *App) RemoveEncoder(mediaType string) {
+	mediaType = strings.ToLower(mediaType)
+	for i, me := range app.encoders {
+		if me.mediaType == mediaType {
+			app.encoders = append(app.encoders[:i], app.encoders[i+1:]...)
+			return
+		}
+	}
+}
+
+type acceptRange struct {
+	mediaType string
+	q         float64
+}
+
+// parseAccept parses an Accept header into media ranges with their
+// quality value.
+func parseAccept(header string) []acceptRange {
+	var ranges []acceptRange
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+		if mediaType == "" {
+			continue
+		}
+		if mediaType == "*" {
+			mediaType = "*/*"
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+				if v, err := strconv.ParseFloat(kv[1], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		ranges = append(ranges, acceptRange{mediaType, q})
+	}
+	return ranges
+}
+
+// acceptQuality returns the quality value the most specific range of
+// ranges gives to mediaType, or -1 if no range matches.
+func acceptQuality(ranges []acceptRange, mediaType string) float64 {
+	q, specificity := -1.0, -1
+	slash := strings.Index(mediaType, "/")
+	for _, r := range ranges {
+		var s int
+		switch {
+		case r.mediaType == mediaType:
+			s = 2
+		case slash > 0 && r.mediaType == mediaType[:slash]+"/*":
+			s = 1
+		case r.mediaType == "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s > specificity {
+			q, specificity = r.q, s
+		}
+	}
+	return q
+}
+
+// negotiate returns the offer preferred by the Accept header, offers
+// being sorted by the server preference. It returns an empty string
+// when none is acceptable.
+func negotiate(header string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(header) == "" {
+		return offers[0]
+	}
+	ranges := parseAccept(header)
+	var best string
+	bestQ := 0.0
+	for _, offer := range offers {
+		if q := acceptQuality(ranges, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+// Respond writes obj in the format preferred by the request's Accept
+// header among the App's encoders: JSON, XML, plain text, MessagePack
+// and CSV by default. When a template is given, text/html is offered
+// too and the template is rendered with obj as the Data variable.
+// A 406 response is sent when no format is acceptable.
+func (c *Action) Respond(obj interface{}, tmpl ...string) error {
+	offers := make([]string, 0, len(c.App.encoders)+1)
+	if len(tmpl) > 0 {
+		offers = append(offers, "text/html")
+	}
+	for _, me := range c.App.encoders {
+		offers = append(offers, me.mediaType)
+	}
+
+	addVary(c.ResponseWriter.Header(), "Accept")
+	mediaType := negotiate(c.Header("Accept"), offers)
+	if mediaType == "" {
+		return c.Abort(http.StatusNotAcceptable, "Supported formats: "+strings.Join(offers, ", "))
+	}
+
+	if mediaType == "text/html" {
+		return c.Render(tmpl[0], &T{"Data": obj})
+	}
+
+	var buf bytes.Buffer
+	for _, me := range c.App.encoders {
+		if me.mediaType != mediaType {
+			continue
+		}
+		if err := me.encoder.Encode(&buf, obj); err != nil {
+			return err
+		}
+		break
+	}
+	if strings.HasPrefix(mediaType, "text/") {
+		c.SetHeader("Content-Type", mediaType+"; charset=utf-8")
+	} else {
+		c.SetHeader("Content-Type", mediaType)
+	}
+	return c.SetBody(buf.Bytes())
+}
+
+// csvEncode writes a [][]string, a slice of structs or a slice of
+// maps as CSV. Structs give a header row of their field names and maps
+// one of their sorted keys.
+func csvEncode(w io.Writer, obj interface{}) error {
+	cw := csv.NewWriter(w)
+	if records, ok := obj.([][]string); ok {
+		return cw.WriteAll(records)
+	}
+
+	v := reflect.Indirect(reflect.ValueOf(obj))
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return fmt.Errorf("csv: unsupported type %T", obj)
+	}
+	if v.Len() == 0 {
+		return nil
+	}
+
+	first := reflect.Indirect(v.Index(0))
+	var header []string
+	switch first.Kind() {
+	case reflect.Struct:
+		for i := 0; i < first.NumField(); i++ {
+			if f := first.Type().Field(i); f.PkgPath == "" {
+				header = append(header, f.Name)
+			}
+		}
+	case reflect.Map:
+		if first.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("csv: unsupported element type %v", first.Type())
+		}
+		for _, key := range first.MapKeys() {
+			header = append(header, key.String())
+		}
+		sort.Strings(header)
+	default:
+		return fmt.Errorf("csv: unsupported element type %v", first.Type())
+	}
+
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	record := make([]string, len(header))
+	for i := 0; i < v.Len(); i++ {
+		row := reflect.Indirect(v.Index(i))
+		for j, name := range header {
+			var field reflect.Value
+			if row.Kind() == reflect.Struct {
+				field = row.FieldByName(name)
+			} else {
+				field = row.MapIndex(reflect.ValueOf(name).Convert(row.Type().Key()))
+			}
+			if field.IsValid() {
+				record[j] = fmt.Sprint(field.Interface())
+			} else {
+				record[j] = ""
+			}
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
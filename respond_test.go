@@ -0,0 +1,184 @@
+package xweb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-xweb/log"
+)
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{"application/json", "application/xml", "text/plain"}
+	cases := map[string]string{
+		"":                                     "application/json",
+		"*/*":                                  "application/json",
+		"application/xml":                      "application/xml",
+		"text/*;q=0.9, application/json;q=0.5": "text/plain",
+		"application/*;q=0.2, application/xml": "application/xml",
+		"application/json;q=0, */*;q=0.1":      "application/xml",
+		"image/png":                            "",
+		"text/html, application/xhtml+xml, */*;q=0.8": "application/json",
+	}
+	for header, expected := range cases {
+		if got := negotiate(header, offers); got != expected {
+			t.Errorf("negotiate(%q) = %q, expected %q", header, got, expected)
+		}
+	}
+}
+
+func TestMsgpackMarshal(t *testing.T) {
+	type item struct {
+		Name  string `json:"name"`
+		Count int
+		Skip  bool `msgpack:"-"`
+	}
+	content, err := msgpackMarshal(item{"a", -1, true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []byte{0x82, 0xa4, 'n', 'a', 'm', 'e', 0xa1, 'a', 0xa5, 'C', 'o', 'u', 'n', 't', 0xff}
+	if !bytes.Equal(content, expected) {
+		t.Errorf("got %x, expected %x", content, expected)
+	}
+}
+
+func TestCsvEncode(t *testing.T) {
+	type row struct {
+		Id   int
+		Name string
+	}
+	var buf bytes.Buffer
+	if err := csvEncode(&buf, []row{{1, "a"}, {2, "b,c"}}); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "Id,Name\n1,a\n2,\"b,c\"\n" {
+		t.Errorf("unexpected csv %q", buf.String())
+	}
+}
+
+type jsonAction struct {
+	*Action
+	ok     Mapper `xweb:"/ok"`
+	bad    Mapper `xweb:"/bad"`
+	stream Mapper `xweb:"/stream"`
+	later  Mapper `xweb:"/later"`
+}
+
+func (a *jsonAction) Ok() error {
+	return a.ServeJson(map[string]int{"a": 1})
+}
+
+func (a *jsonAction) Bad() error {
+	return a.ServeJson(make(chan int))
+}
+
+func (a *jsonAction) Stream() error {
+	sent := false
+	return a.StreamJson(func() (interface{}, bool) {
+		if sent {
+			return nil, false
+		}
+		sent = true
+		return make(chan int), true
+	})
+}
+
+func (a *jsonAction) Later() error {
+	values := []interface{}{map[string]int{"a": 1}, make(chan int)}
+	return a.StreamJson(func() (interface{}, bool) {
+		if len(values) == 0 {
+			return nil, false
+		}
+		v := values[0]
+		values = values[1:]
+		return v, true
+	})
+}
+
+func TestServeJson(t *testing.T) {
+	s := NewServer("json")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.AddAction(&jsonAction{})
+	var reported []error
+	s.RootApp.ErrorHandler = func(c *Action, err error) error {
+		reported = append(reported, err)
+		return err
+	}
+	s.initServer()
+
+	get := func(path string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "text/plain")
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	// JSONP is disabled, the callback parameter is ignored
+	if w := get("/ok?callback=cb"); w.Code != 200 || w.Body.String() != `{"a":1}` {
+		t.Errorf("GET /ok?callback=cb = %v %q", w.Code, w.Body.String())
+	}
+	s.RootApp.AppConfig.JsonpCallbacks = []string{"jsonp_*"}
+	if w := get("/ok?callback=cb"); w.Code != 400 {
+		t.Errorf("GET /ok?callback=cb = %v, want 400", w.Code)
+	}
+	if w := get("/ok?callback=jsonp_1"); w.Body.String() != `/**/jsonp_1({"a":1});` {
+		t.Errorf("GET /ok?callback=jsonp_1 = %q", w.Body.String())
+	}
+
+	// the encoding errors are sent once
+	for _, path := range []string{"/bad", "/stream"} {
+		if w := get(path); w.Code != 500 || w.Body.String() != "500 Internal Server Error\nJSON encoding error\n" {
+			t.Errorf("GET %v = %v %q", path, w.Code, w.Body.String())
+		}
+	}
+
+	// a later error cuts the stream short and is reported
+	reported = nil
+	if w := get("/later"); w.Code != 200 || w.Body.String() != "{\"a\":1}\n" {
+		t.Errorf("GET /later = %v %q", w.Code, w.Body.String())
+	}
+	if len(reported) != 1 || !strings.Contains(reported[0].Error(), "StreamJson") {
+		t.Errorf("reported %v, want the encoding error", reported)
+	}
+}
+
+type respondAction struct {
+	*Action
+	data Mapper `xweb:"/data"`
+}
+
+func (a *respondAction) Data() error {
+	// e.g. set by a filter or a previous Respond
+	a.SetHeader("Vary", "accept")
+	return a.Respond(map[string]int{"a": 1})
+}
+
+func TestRespondVary(t *testing.T) {
+	s := NewServer("respond")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.AddAction(&respondAction{})
+	s.initServer()
+
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest("GET", "/data", nil)
+	req.Header.Set("Accept", "application/json")
+	s.ServeHTTP(w, req)
+	if w.Code != 200 {
+		t.Fatalf("GET /data = %v %q", w.Code, w.Body.String())
+	}
+	n := 0
+	for _, v := range w.Header()["Vary"] {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), "Accept") {
+				n++
+			}
+		}
+	}
+	if n != 1 {
+		t.Errorf("Vary = %q, want Accept once", w.Header()["Vary"])
+	}
+}
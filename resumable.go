@@ -0,0 +1,556 @@
+package xweb
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-xweb/uuid"
+)
+
+// TusVersion is the version of the tus resumable upload protocol
+// implemented by Resumable.
+const TusVersion = "1.0.0"
+
+var (
+	ErrUploadNotFound = errors.New("upload not found")
+)
+
+// UploadInfo describes a resumable upload.
+type UploadInfo struct {
+	Id        string
+	Size      int64
+	Offset    int64
+	Metadata  map[string]string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// IsComplete returns whether all the bytes of the upload were received.
+func (info *UploadInfo) IsComplete() bool {
+	return info.Offset == info.Size
+}
+
+// UploadStore is the storage backend of resumable uploads.
+type UploadStore interface {
+	// Create allocates the storage for a new upload.
+	Create(info *UploadInfo) error
+	// Info returns the stored information of the upload, or
+	// ErrUploadNotFound.
+	Info(id string) (*UploadInfo, error)
+	// WriteChunk appends the content of r at offset and returns the
+	// number of bytes written. The stored offset must be updated even
+	// when an error is returned after some bytes were written.
+	WriteChunk(id string, offset int64, r io.Reader) (int64, error)
+	// Truncate discards everything stored after offset.
+	Truncate(id string, offset int64) error
+	// Open opens the uploaded content for reading.
+	Open(id string) (io.ReadCloser, error)
+	// Remove deletes the upload.
+	Remove(id string) error
+	// List returns all the stored uploads.
+	List() ([]*UploadInfo, error)
+}
+
+// FileUploadStore stores resumable uploads in a local directory, the
+// content in <id>.bin and the information in <id>.info.
+type FileUploadStore struct {
+	Dir string
+}
+
+func NewFileUploadStore(dir string) (*FileUploadStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &FileUploadStore{Dir: dir}, nil
+}
+
+// Path returns the path of the uploaded content, so that finished
+// uploads can be moved instead of copied.
+func (s *FileUploadStore) Path(id string) string {
+	return filepath.Join(s.Dir, id+".bin")
+}
+
+func (s *FileUploadStore) infoPath(id string) string {
+	return filepath.Join(s.Dir, id+".info")
+}
+
+func (s *FileUploadStore) saveInfo(info *UploadInfo) error {
+	content, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+	tmp := s.infoPath(info.Id) + ".tmp"
+	if err = ioutil.WriteFile(tmp, content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.infoPath(info.Id))
+}
+
+func (s *FileUploadStore) Create(info *UploadInfo) error {
+	f, err := os.OpenFile(s.Path(info.Id), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return s.saveInfo(info)
+}
+
+func (s *FileUploadStore) Info(id string) (*UploadInfo, error) {
+	// ids come from the url, don't let them escape the directory
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return nil, ErrUploadNotFound
+	}
+	content, err := ioutil.ReadFile(s.infoPath(id))
+	if os.IsNotExist(err) {
+		return nil, ErrUploadNotFound
+	} else if err != nil {
+		return nil, err
+	}
+	var info UploadInfo
+	if err = json.Unmarshal(content, &info); err != nil {
+		return nil, err
+	}
+	return &info, nil
+}
+
+func (s *FileUploadStore) WriteChunk(id string, offset int64, r io.Reader) (int64, error) {
+	info, err := s.Info(id)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(s.Path(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if n > 0 {
+		info.Offset = offset + n
+		if e := s.saveInfo(info); e != nil && err == nil {
+			err = e
+		}
+	}
+	return n, err
+}
+
+func (s *FileUploadStore) Truncate(id string, offset int64) error {
+	info, err := s.Info(id)
+	if err != nil {
+		return err
+	}
+	if err = os.Truncate(s.Path(id), offset); err != nil {
+		return err
+	}
+	info.Offset = offset
+	return s.saveInfo(info)
+}
+
+func (s *FileUploadStore) Open(id string) (io.ReadCloser, error) {
+	if _, err := s.Info(id); err != nil {
+		return nil, err
+	}
+	return os.Open(s.Path(id))
+}
+
+func (s *FileUploadStore) Remove(id string) error {
+	if _, err := s.Info(id); err != nil {
+		return err
+	}
+	// the content may already have been moved away by the application
+	if err := os.Remove(s.Path(id)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return os.Remove(s.infoPath(id))
+}
+
+func (s *FileUploadStore) List() ([]*UploadInfo, error) {
+	names, err := filepath.Glob(filepath.Join(s.Dir, "*.info"))
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]*UploadInfo, 0, len(names))
+	for _, name := range names {
+		info, err := s.Info(strings.TrimSuffix(filepath.Base(name), ".info"))
+		if err != nil {
+			continue
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// Resumable implements the tus resumable upload protocol
+// (http://tus.io) with the creation, checksum, expiration and
+// termination extensions. A route serving it must accept the
+// POST, HEAD, PATCH, DELETE and OPTIONS methods and should use the
+// stream option, the last path segment being the upload id:
+//
+//	type UploadAction struct {
+//		*xweb.Action
+//
+//		files xweb.Mapper `xweb:"POST|PATCH|DELETE|OPTIONS /files/?(.*) stream"`
+//	}
+//
+//	func (c *UploadAction) Init() {
+//		c.Option.CheckXsrf = false
+//	}
+//
+//	func (c *UploadAction) Files(id string) error {
+//		return c.ServeResumable(uploads, id)
+//	}
+type Resumable struct {
+	Store UploadStore
+	// MaxSize is the largest upload accepted, 0 means no limit.
+	MaxSize int64
+	// Expiration is how long an upload is kept after its creation,
+	// 0 means forever.
+	Expiration time.Duration
+	// OnComplete is called once the last chunk of an upload was
+	// received. The upload is removed from the store when it returns
+	// nil, so the file must be copied or moved by the callback.
+	// Without it completed uploads stay in the store until they expire.
+	OnComplete func(c *Action, info *UploadInfo, file io.ReadCloser) error
+
+	mutex  sync.Mutex
+	active map[string]bool
+}
+
+func NewResumable(store UploadStore) *Resumable {
+	return &Resumable{
+		Store:      store,
+		Expiration: 24 * time.Hour,
+		active:     make(map[string]bool),
+	}
+}
+
+var checksumAlgorithms = map[string]func() hash.Hash{
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+}
+
+func (r *Resumable) checksumAlgorithmNames() string {
+	names := make([]string, 0, len(checksumAlgorithms))
+	for name := range checksumAlgorithms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ",")
+}
+
+// lock marks the upload as being written, concurrent PATCH requests
+// for the same upload are refused.
+func (r *Resumable) lock(id string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.active == nil {
+		r.active = make(map[string]bool)
+	}
+	if r.active[id] {
+		return false
+	}
+	r.active[id] = true
+	return true
+}
+
+func (r *Resumable) unlock(id string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.active, id)
+}
+
+// Expire removes the uploads whose expiration date has passed and
+// returns how many were removed.
+func (r *Resumable) Expire() (int, error) {
+	infos, err := r.Store.List()
+	if err != nil {
+		return 0, err
+	}
+	now := time.Now()
+	var count int
+	for _, info := range infos {
+		if info.ExpiresAt.IsZero() || info.ExpiresAt.After(now) {
+			continue
+		}
+		if !r.lock(info.Id) {
+			continue
+		}
+		err = r.Store.Remove(info.Id)
+		r.unlock(info.Id)
+		if err != nil {
+			return count, err
+		}
+		count++
+	}
+	return count, nil
+}
+
+// Run removes expired uploads every interval in background until
+// the returned function is called.
+func (r *Resumable) Run(interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				r.Expire()
+			case <-done:
+				return
+			}
+		}
+	}()
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+func parseUploadMetadata(s string) map[string]string {
+	metadata := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		kv := strings.Fields(pair)
+		if len(kv) == 0 {
+			continue
+		}
+		var value string
+		if len(kv) > 1 {
+			v, err := base64.StdEncoding.DecodeString(kv[1])
+			if err != nil {
+				continue
+			}
+			value = string(v)
+		}
+		metadata[kv[0]] = value
+	}
+	return metadata
+}
+
+func formatUploadMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for k, v := range metadata {
+		pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(v)))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (c *Action) tusStatus(status int, message string) error {
+	c.StatusCode = status
+	c.SetHeader("Content-Type", "text/plain; charset=utf-8")
+	c.ResponseWriter.WriteHeader(status)
+	if message != "" {
+		_, err := io.WriteString(c.ResponseWriter, message)
+		return err
+	}
+	return nil
+}
+
+// ServeResumable handles a request of the tus protocol for the upload
+// id. id is empty when creating a new upload.
+func (c *Action) ServeResumable(r *Resumable, id string) error {
+	c.SetHeader("Tus-Resumable", TusVersion)
+	c.SetHeader("Cache-Control", "no-store")
+
+	method := c.Method()
+	if override := c.Header("X-HTTP-Method-Override"); override != "" && method == "POST" {
+		method = strings.ToUpper(override)
+	}
+
+	if method == "OPTIONS" {
+		c.SetHeader("Tus-Version", TusVersion)
+		c.SetHeader("Tus-Extension", "creation,checksum,expiration,termination")
+		c.SetHeader("Tus-Checksum-Algorithm", r.checksumAlgorithmNames())
+		if r.MaxSize > 0 {
+			c.SetHeader("Tus-Max-Size", strconv.FormatInt(r.MaxSize, 10))
+		}
+		return c.tusStatus(http.StatusNoContent, "")
+	}
+
+	if c.Header("Tus-Resumable") != TusVersion {
+		c.SetHeader("Tus-Version", TusVersion)
+		return c.tusStatus(http.StatusPreconditionFailed, "unsupported tus version")
+	}
+
+	if method == "POST" {
+		return c.createUpload(r)
+	}
+
+	info, err := r.Store.Info(id)
+	if err == ErrUploadNotFound {
+		return c.tusStatus(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return err
+	}
+	if !info.IsComplete() && !info.ExpiresAt.IsZero() && info.ExpiresAt.Before(time.Now()) {
+		return c.tusStatus(http.StatusGone, "upload expired")
+	}
+
+	switch method {
+	case "HEAD", "GET":
+		c.SetHeader("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+		c.SetHeader("Upload-Length", strconv.FormatInt(info.Size, 10))
+		if len(info.Metadata) > 0 {
+			c.SetHeader("Upload-Metadata", formatUploadMetadata(info.Metadata))
+		}
+		return c.tusStatus(http.StatusOK, "")
+	case "PATCH":
+		return c.patchUpload(r, info)
+	case "DELETE":
+		if !r.lock(id) {
+			return c.tusStatus(http.StatusLocked, "upload is in use")
+		}
+		defer r.unlock(id)
+		if err = r.Store.Remove(id); err != nil {
+			return err
+		}
+		return c.tusStatus(http.StatusNoContent, "")
+	}
+	return c.tusStatus(http.StatusMethodNotAllowed, statusText[http.StatusMethodNotAllowed])
+}
+
+func (c *Action) createUpload(r *Resumable) error {
+	size, err := strconv.ParseInt(c.Header("Upload-Length"), 10, 64)
+	if err != nil || size < 0 {
+		return c.tusStatus(http.StatusBadRequest, "invalid Upload-Length")
+	}
+	if r.MaxSize > 0 && size > r.MaxSize {
+		return c.tusStatus(http.StatusRequestEntityTooLarge, statusText[http.StatusRequestEntityTooLarge])
+	}
+
+	now := time.Now()
+	info := &UploadInfo{
+		Id:        strings.Replace(uuid.NewRandom().String(), "-", "", -1),
+		Size:      size,
+		Metadata:  parseUploadMetadata(c.Header("Upload-Metadata")),
+		CreatedAt: now,
+	}
+	if r.Expiration > 0 {
+		info.ExpiresAt = now.Add(r.Expiration)
+	}
+	if err = r.Store.Create(info); err != nil {
+		return err
+	}
+
+	c.SetHeader("Location", strings.TrimRight(c.Request.URL.Path, "/")+"/"+info.Id)
+	if !info.ExpiresAt.IsZero() {
+		c.SetHeader("Upload-Expires", webTime(info.ExpiresAt.UTC()))
+	}
+	if size == 0 {
+		if err = c.completeUpload(r, info); err != nil {
+			return err
+		}
+	}
+	return c.tusStatus(http.StatusCreated, "")
+}
+
+func (c *Action) patchUpload(r *Resumable, info *UploadInfo) error {
+	if c.Header("Content-Type") != "application/offset+octet-stream" {
+		return c.tusStatus(http.StatusUnsupportedMediaType, "Content-Type must be application/offset+octet-stream")
+	}
+	offset, err := strconv.ParseInt(c.Header("Upload-Offset"), 10, 64)
+	if err != nil {
+		return c.tusStatus(http.StatusConflict, "Upload-Offset does not match")
+	}
+
+	var hasher hash.Hash
+	var sum []byte
+	if checksum := c.Header("Upload-Checksum"); checksum != "" {
+		parts := strings.Fields(checksum)
+		if len(parts) != 2 {
+			return c.tusStatus(http.StatusBadRequest, "invalid Upload-Checksum")
+		}
+		newHash, ok := checksumAlgorithms[parts[0]]
+		if !ok {
+			return c.tusStatus(http.StatusBadRequest, "unsupported checksum algorithm")
+		}
+		if sum, err = base64.StdEncoding.DecodeString(parts[1]); err != nil {
+			return c.tusStatus(http.StatusBadRequest, "invalid Upload-Checksum")
+		}
+		hasher = newHash()
+	}
+
+	if !r.lock(info.Id) {
+		return c.tusStatus(http.StatusLocked, "upload is in use")
+	}
+	defer r.unlock(info.Id)
+	// the upload may have changed since ServeResumable read it
+	if info, err = r.Store.Info(info.Id); err == ErrUploadNotFound {
+		return c.tusStatus(http.StatusNotFound, err.Error())
+	} else if err != nil {
+		return err
+	}
+	if offset != info.Offset {
+		return c.tusStatus(http.StatusConflict, "Upload-Offset does not match")
+	}
+
+	// never accept more than what is left of the declared size
+	var body io.Reader = http.MaxBytesReader(c.ResponseWriter, c.Request.Body, info.Size-info.Offset)
+	if hasher != nil {
+		body = io.TeeReader(body, hasher)
+	}
+	n, err := r.Store.WriteChunk(info.Id, info.Offset, body)
+	if err != nil {
+		// keep what was received, the client resumes from the new offset,
+		// unless the chunk has to be verified as a whole
+		if hasher != nil && n > 0 {
+			r.Store.Truncate(info.Id, offset)
+		}
+		c.Errorf("resumable upload %v: %v", info.Id, err)
+		return c.tusStatus(http.StatusBadRequest, "upload interrupted")
+	}
+	if hasher != nil && !bytes.Equal(hasher.Sum(nil), sum) {
+		if err = r.Store.Truncate(info.Id, offset); err != nil {
+			return err
+		}
+		return c.tusStatus(460, "checksum mismatch")
+	}
+
+	info.Offset = offset + n
+	c.SetHeader("Upload-Offset", strconv.FormatInt(info.Offset, 10))
+	if !info.ExpiresAt.IsZero() {
+		c.SetHeader("Upload-Expires", webTime(info.ExpiresAt.UTC()))
+	}
+	if info.IsComplete() {
+		if err = c.completeUpload(r, info); err != nil {
+			return err
+		}
+	}
+	return c.tusStatus(http.StatusNoContent, "")
+}
+
+func (c *Action) completeUpload(r *Resumable, info *UploadInfo) error {
+	if r.OnComplete == nil {
+		return nil
+	}
+	file, err := r.Store.Open(info.Id)
+	if err != nil {
+		return err
+	}
+	err = r.OnComplete(c, info, file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+	return r.Store.Remove(info.Id)
+}
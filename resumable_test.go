@@ -0,0 +1,162 @@
+package xweb
+
+import (
+	"crypto/sha1"
+	"encoding/base64"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-xweb/log"
+)
+
+var testUploads *Resumable
+
+type resumableAction struct {
+	*Action
+	files Mapper `xweb:"POST|HEAD|PATCH|DELETE|OPTIONS /files/?(.*) stream"`
+}
+
+func (c *resumableAction) Init() {
+	c.Option.CheckXsrf = false
+}
+
+func (c *resumableAction) Files(id string) error {
+	return c.ServeResumable(testUploads, id)
+}
+
+func TestResumable(t *testing.T) {
+	store, err := NewFileUploadStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	testUploads = NewResumable(store)
+	var completed string
+	testUploads.OnComplete = func(c *Action, info *UploadInfo, file io.ReadCloser) error {
+		content, err := ioutil.ReadAll(file)
+		completed = info.Metadata["filename"] + ":" + string(content)
+		return err
+	}
+
+	s := NewServer("resumable")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.AddAction(&resumableAction{})
+	s.initServer()
+
+	do := func(method, path, body string, header ...string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Tus-Resumable", TusVersion)
+		if method == "PATCH" {
+			req.Header.Set("Content-Type", "application/offset+octet-stream")
+		}
+		for i := 0; i+1 < len(header); i += 2 {
+			req.Header.Set(header[i], header[i+1])
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+	offset := func(path string) string {
+		w := do("HEAD", path, "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("HEAD %v = %v", path, w.Code)
+		}
+		return w.Header().Get("Upload-Offset")
+	}
+
+	w := do("POST", "/files/", "", "Upload-Length", "11",
+		"Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("hello.txt")))
+	location := w.Header().Get("Location")
+	if w.Code != http.StatusCreated || !strings.HasPrefix(location, "/files/") {
+		t.Fatalf("POST = %v %q", w.Code, location)
+	}
+	if got := offset(location); got != "0" {
+		t.Errorf("offset = %v, want 0", got)
+	}
+
+	if w = do("PATCH", location, "hello ", "Upload-Offset", "0"); w.Code != http.StatusNoContent || w.Header().Get("Upload-Offset") != "6" {
+		t.Errorf("PATCH = %v %v", w.Code, w.Header().Get("Upload-Offset"))
+	}
+	if w = do("PATCH", location, "hello ", "Upload-Offset", "0"); w.Code != http.StatusConflict {
+		t.Errorf("PATCH at a past offset = %v, want 409", w.Code)
+	}
+
+	// a PATCH holding info read before the previous one finished
+	id := strings.TrimPrefix(location, "/files/")
+	stale := &UploadInfo{Id: id, Size: 11, Offset: 0}
+	req := httptest.NewRequest("PATCH", location, strings.NewReader("HELLO "))
+	req.Header.Set("Content-Type", "application/offset+octet-stream")
+	req.Header.Set("Upload-Offset", "0")
+	rec := httptest.NewRecorder()
+	c := &Action{Request: req, ResponseWriter: rec, App: s.RootApp, T: T{}, f: T{}}
+	if err = c.patchUpload(testUploads, stale); err != nil || rec.Code != http.StatusConflict {
+		t.Errorf("stale PATCH = %v %v, want 409", rec.Code, err)
+	}
+
+	if w = do("PATCH", location, "world", "Upload-Offset", "6", "Upload-Checksum", "sha1 "+base64.StdEncoding.EncodeToString(make([]byte, 20))); w.Code != 460 {
+		t.Errorf("PATCH with a bad checksum = %v, want 460", w.Code)
+	}
+	if got := offset(location); got != "6" {
+		t.Errorf("offset after the bad checksum = %v, want 6", got)
+	}
+	sum := sha1.Sum([]byte("world"))
+	if w = do("PATCH", location, "world", "Upload-Offset", "6", "Upload-Checksum", "sha1 "+base64.StdEncoding.EncodeToString(sum[:])); w.Code != http.StatusNoContent {
+		t.Errorf("last PATCH = %v", w.Code)
+	}
+	if completed != "hello.txt:hello world" {
+		t.Errorf("completed = %q", completed)
+	}
+	if w = do("HEAD", location, ""); w.Code != http.StatusNotFound {
+		t.Errorf("HEAD of a completed upload = %v, want 404", w.Code)
+	}
+
+	// expiration
+	w = do("POST", "/files/", "", "Upload-Length", "5")
+	location = w.Header().Get("Location")
+	info, err := store.Info(strings.TrimPrefix(location, "/files/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.ExpiresAt = time.Now().Add(-time.Minute)
+	if err = store.saveInfo(info); err != nil {
+		t.Fatal(err)
+	}
+	if w = do("HEAD", location, ""); w.Code != http.StatusGone {
+		t.Errorf("HEAD of an expired upload = %v, want 410", w.Code)
+	}
+	if n, err := testUploads.Expire(); n != 1 || err != nil {
+		t.Errorf("Expire() = %v, %v", n, err)
+	}
+	if w = do("HEAD", location, ""); w.Code != http.StatusNotFound {
+		t.Errorf("HEAD of a removed upload = %v, want 404", w.Code)
+	}
+
+	// without OnComplete a completed upload is kept until it expires
+	testUploads.OnComplete = nil
+	w = do("POST", "/files/", "", "Upload-Length", "2")
+	location = w.Header().Get("Location")
+	if w = do("PATCH", location, "hi", "Upload-Offset", "0"); w.Code != http.StatusNoContent {
+		t.Fatalf("PATCH = %v", w.Code)
+	}
+	if got := offset(location); got != "2" {
+		t.Errorf("offset of a completed upload = %v, want 2", got)
+	}
+	info, err = store.Info(strings.TrimPrefix(location, "/files/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info.ExpiresAt = time.Now().Add(-time.Minute)
+	if err = store.saveInfo(info); err != nil {
+		t.Fatal(err)
+	}
+	stop := testUploads.Run(time.Millisecond)
+	waitFor(t, "the completed upload to expire", func() bool {
+		return do("HEAD", location, "").Code == http.StatusNotFound
+	})
+	stop()
+	stop()
+}
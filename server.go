@@ -25,6 +25,9 @@ type ServerConfig struct {
 	Profiler               bool
 	EnableGzip             bool
 	StaticExtensionsToGzip []string
+	CompressMinSize        int      // smaller responses are not compressed
+	CompressMimeTypes      []string // compressed dynamic responses, e.g. text/*
+	CompressEncodings      []string // offered codings in order of preference
 	Url                    string
 	UrlPrefix              string
 	UrlSuffix              string
@@ -124,7 +127,7 @@ func (s *Server) GetConfig(name string) interface{} {
 }
 
 func (s *Server) error(w http.ResponseWriter, status int, content string) error {
-	return s.RootApp.error(w, status, content)
+	return s.RootApp.error(w, nil, status, content)
 }
 
 func (s *Server) initServer() {
@@ -0,0 +1,306 @@
+package xweb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrStreamingUnsupported = errors.New("the ResponseWriter does not support streaming")
+	ErrStreamClosed         = errors.New("the event stream is closed")
+)
+
+// EventStream writes Server-Sent Events to a client. It is returned by
+// Action.SSE and is safe for concurrent use.
+type EventStream struct {
+	w       io.Writer
+	flusher http.Flusher
+	mutex   sync.Mutex
+	done    <-chan struct{}
+	closed  bool
+	stop    chan struct{} // closed by Close
+	stopped bool
+
+	lastEventId string
+}
+
+// SSE starts a text/event-stream response. The headers are sent
+// immediately, so nothing else must be written by the handler.
+func (c *Action) SSE() (*EventStream, error) {
+	flusher, ok := c.ResponseWriter.(http.Flusher)
+	if !ok {
+		return nil, ErrStreamingUnsupported
+	}
+
+	lastEventId := c.Header("Last-Event-ID")
+	if lastEventId == "" {
+		// EventSource polyfills can't set headers
+		lastEventId = c.Request.URL.Query().Get("lastEventId")
+	}
+
+	h := c.ResponseWriter.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	h.Set("Connection", "keep-alive")
+	h.Set("X-Accel-Buffering", "no")
+	h.Del("Content-Length")
+	c.StatusCode = http.StatusOK
+	c.ResponseWriter.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	c.eventStream = newEventStream(c.ResponseWriter, flusher, c.Request.Context().Done(), lastEventId)
+	return c.eventStream, nil
+}
+
+func newEventStream(w io.Writer, flusher http.Flusher, done <-chan struct{}, lastEventId string) *EventStream {
+	return &EventStream{
+		w:           w,
+		flusher:     flusher,
+		done:        done,
+		stop:        make(chan struct{}),
+		lastEventId: lastEventId,
+	}
+}
+
+// LastEventId returns the id of the last event received by the client
+// before it reconnected, or an empty string.
+func (s *EventStream) LastEventId() string {
+	return s.lastEventId
+}
+
+// Done returns a channel closed when the client disconnects.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.done
+}
+
+// Close ends the stream, the heartbeat stops and the next events fail
+// with ErrStreamClosed. It's called once the handler of the action
+// returned, the response can't be written anymore then.
+func (s *EventStream) Close() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.closed = true
+	if !s.stopped {
+		s.stopped = true
+		close(s.stop)
+	}
+}
+
+// Closed returns whether the client went away or the stream was closed.
+func (s *EventStream) Closed() bool {
+	select {
+	case <-s.done:
+		return true
+	default:
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.closed
+}
+
+func (s *EventStream) write(content string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.closed {
+		return ErrStreamClosed
+	}
+	select {
+	case <-s.done:
+		s.closed = true
+		return ErrStreamClosed
+	default:
+	}
+	if _, err := io.WriteString(s.w, content); err != nil {
+		s.closed = true
+		return err
+	}
+	s.flusher.Flush()
+	return nil
+}
+
+// Send sends an event. event and id may be empty. data is written
+// as is when it is a string or a []byte, otherwise it is encoded as
+// JSON.
+func (s *EventStream) Send(event, id string, data interface{}) error {
+	var payload string
+	switch d := data.(type) {
+	case string:
+		payload = d
+	case []byte:
+		payload = string(d)
+	default:
+		content, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		payload = string(content)
+	}
+
+	var buf strings.Builder
+	if id != "" {
+		buf.WriteString("id: " + sseField(id) + "\n")
+	}
+	if event != "" {
+		buf.WriteString("event: " + sseField(event) + "\n")
+	}
+	payload = strings.Replace(payload, "\r\n", "\n", -1)
+	for _, line := range strings.Split(payload, "\n") {
+		buf.WriteString("data: " + line + "\n")
+	}
+	buf.WriteString("\n")
+	return s.write(buf.String())
+}
+
+// sseField strips the line breaks that would end a field early.
+func sseField(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// Retry tells the client how long to wait before reconnecting.
+func (s *EventStream) Retry(d time.Duration) error {
+	return s.write("retry: " + strconv.FormatInt(int64(d/time.Millisecond), 10) + "\n\n")
+}
+
+// Comment sends a comment line, which clients ignore.
+func (s *EventStream) Comment(text string) error {
+	return s.write(": " + sseField(text) + "\n\n")
+}
+
+// Heartbeat sends a comment every interval in background until the
+// client disconnects or the stream is closed, keeping proxies from
+// closing an idle connection.
+func (s *EventStream) Heartbeat(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.done:
+				return
+			case <-s.stop:
+				return
+			case <-ticker.C:
+				if s.Comment("heartbeat") != nil {
+					return
+				}
+			}
+		}
+	}()
+}
+
+// Event is a Server-Sent Event published through a Broadcaster.
+type Event struct {
+	Id    string
+	Event string
+	Data  interface{}
+}
+
+// Broadcaster sends the events it is given to every subscribed
+// EventStream. It keeps the last events so that reconnecting clients
+// get the ones they missed, based on their Last-Event-ID.
+type Broadcaster struct {
+	// BufferSize is the number of events queued for a client. A client
+	// falling further behind is disconnected and resumes on reconnect.
+	BufferSize int
+
+	mutex       sync.Mutex
+	clients     map[chan *Event]bool
+	history     []*Event
+	historySize int
+	lastId      uint64
+}
+
+// NewBroadcaster returns a Broadcaster keeping the last historySize
+// events for resuming clients.
+func NewBroadcaster(historySize int) *Broadcaster {
+	return &Broadcaster{
+		BufferSize:  16,
+		clients:     make(map[chan *Event]bool),
+		historySize: historySize,
+	}
+}
+
+// Publish sends an event to all the subscribers and returns its id.
+func (b *Broadcaster) Publish(event string, data interface{}) string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.lastId++
+	ev := &Event{Id: strconv.FormatUint(b.lastId, 10), Event: event, Data: data}
+	if b.historySize > 0 {
+		if len(b.history) >= b.historySize {
+			b.history = b.history[1:]
+		}
+		b.history = append(b.history, ev)
+	}
+	for ch := range b.clients {
+		select {
+		case ch <- ev:
+		default:
+			delete(b.clients, ch)
+			close(ch)
+		}
+	}
+	return ev.Id
+}
+
+// Count returns the number of subscribed clients.
+func (b *Broadcaster) Count() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.clients)
+}
+
+// Serve subscribes s, sends the events it missed and then the
+// published ones until the client disconnects.
+func (b *Broadcaster) Serve(s *EventStream) error {
+	ch := make(chan *Event, b.BufferSize)
+	b.mutex.Lock()
+	var missed []*Event
+	if last, err := strconv.ParseUint(s.LastEventId(), 10, 64); err == nil {
+		for _, ev := range b.history {
+			if id, _ := strconv.ParseUint(ev.Id, 10, 64); id > last {
+				missed = append(missed, ev)
+			}
+		}
+	}
+	if b.clients == nil {
+		b.clients = make(map[chan *Event]bool)
+	}
+	b.clients[ch] = true
+	b.mutex.Unlock()
+
+	defer func() {
+		b.mutex.Lock()
+		if b.clients[ch] {
+			delete(b.clients, ch)
+			close(ch)
+		}
+		b.mutex.Unlock()
+	}()
+
+	for _, ev := range missed {
+		if err := s.Send(ev.Event, ev.Id, ev.Data); err != nil {
+			return err
+		}
+	}
+	for {
+		select {
+		case <-s.Done():
+			return nil
+		case ev, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("event stream too slow, disconnected")
+			}
+			if err := s.Send(ev.Event, ev.Id, ev.Data); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package xweb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-xweb/log"
+)
+
+// flushBuffer is a ResponseWriter body safe for concurrent use.
+type flushBuffer struct {
+	mutex   sync.Mutex
+	buf     bytes.Buffer
+	release chan struct{} // blocks the writes until closed, if set
+}
+
+func (b *flushBuffer) Write(p []byte) (int, error) {
+	if b.release != nil {
+		<-b.release
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *flushBuffer) Flush() {}
+
+func (b *flushBuffer) String() string {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.buf.String()
+}
+
+// waitFor polls cond for a second.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %v", what)
+}
+
+func newTestStream(lastEventId string) (*EventStream, *flushBuffer, chan struct{}) {
+	buf := &flushBuffer{}
+	done := make(chan struct{})
+	return newEventStream(buf, buf, done, lastEventId), buf, done
+}
+
+func TestEventStreamFraming(t *testing.T) {
+	s, buf, done := newTestStream("")
+	defer close(done)
+	s.Send("update", "7\n", "a\nb\r\nc")
+	s.Send("", "", map[string]int{"n": 1})
+	s.Retry(1500 * time.Millisecond)
+	s.Comment("hi")
+	want := "id: 7\nevent: update\ndata: a\ndata: b\ndata: c\n\n" +
+		"data: {\"n\":1}\n\n" +
+		"retry: 1500\n\n" +
+		": hi\n\n"
+	if got := buf.String(); got != want {
+		t.Errorf("stream = %q, want %q", got, want)
+	}
+}
+
+func TestEventStreamClosed(t *testing.T) {
+	s, _, done := newTestStream("")
+	close(done)
+	if err := s.Send("", "", "x"); err != ErrStreamClosed || !s.Closed() {
+		t.Errorf("Send after disconnect = %v", err)
+	}
+}
+
+func TestActionSSE(t *testing.T) {
+	r := httptest.NewRequest("GET", "/events?lastEventId=3", nil)
+	w := httptest.NewRecorder()
+	c := &Action{Request: r, ResponseWriter: w}
+	s, err := c.SSE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.LastEventId() != "3" || w.Header().Get("Content-Type") != "text/event-stream" || !w.Flushed {
+		t.Errorf("SSE = %q %v", s.LastEventId(), w.Header())
+	}
+	r.Header.Set("Last-Event-ID", "5")
+	if s, _ = (&Action{Request: r, ResponseWriter: httptest.NewRecorder()}).SSE(); s.LastEventId() != "5" {
+		t.Errorf("LastEventId = %q, want the header", s.LastEventId())
+	}
+}
+
+func TestEventStreamHeartbeat(t *testing.T) {
+	s, buf, done := newTestStream("")
+	defer close(done)
+	s.Heartbeat(5 * time.Millisecond)
+	waitFor(t, "a heartbeat", func() bool {
+		return strings.HasPrefix(buf.String(), ": heartbeat\n\n")
+	})
+	s.Close()
+	sent := buf.String()
+	time.Sleep(30 * time.Millisecond)
+	if buf.String() != sent {
+		t.Error("the heartbeat went on after Close")
+	}
+	if err := s.Comment("late"); err != ErrStreamClosed {
+		t.Errorf("Comment after Close = %v", err)
+	}
+	s.Close()
+}
+
+var sseTestStream *EventStream
+
+type sseAction struct {
+	*Action
+	events Mapper `xweb:"/events"`
+}
+
+func (a *sseAction) Events() error {
+	s, err := a.SSE()
+	if err != nil {
+		return err
+	}
+	sseTestStream = s
+	s.Heartbeat(time.Millisecond)
+	return s.Send("", "", "hello")
+}
+
+func TestEventStreamClosedOnReturn(t *testing.T) {
+	srv := NewServer("sse")
+	srv.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	srv.AddAction(&sseAction{})
+	srv.initServer()
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/events", nil))
+	if sseTestStream == nil || !sseTestStream.Closed() {
+		t.Error("the stream is still open once the handler returned")
+	}
+}
+
+func TestBroadcasterResume(t *testing.T) {
+	b := NewBroadcaster(3)
+	for _, data := range []string{"a", "b", "c", "d"} {
+		b.Publish("msg", data)
+	}
+	// the history kept 2, 3 and 4, the client got 2
+	s, buf, done := newTestStream("2")
+	errc := make(chan error)
+	go func() { errc <- b.Serve(s) }()
+	waitFor(t, "the subscription", func() bool { return b.Count() == 1 })
+	b.Publish("msg", "e")
+	want := "id: 3\nevent: msg\ndata: c\n\nid: 4\nevent: msg\ndata: d\n\nid: 5\nevent: msg\ndata: e\n\n"
+	waitFor(t, "the events", func() bool { return buf.String() == want })
+	close(done)
+	if err := <-errc; err != nil {
+		t.Errorf("Serve = %v", err)
+	}
+	if b.Count() != 0 {
+		t.Errorf("Count = %v after the disconnect", b.Count())
+	}
+}
+
+func TestBroadcasterSlowClient(t *testing.T) {
+	b := NewBroadcaster(0)
+	b.BufferSize = 1
+	s, buf, done := newTestStream("")
+	defer close(done)
+	buf.release = make(chan struct{})
+	errc := make(chan error)
+	go func() { errc <- b.Serve(s) }()
+	waitFor(t, "the subscription", func() bool { return b.Count() == 1 })
+	for i := 0; i < 3; i++ {
+		b.Publish("msg", i)
+	}
+	if b.Count() != 0 {
+		t.Errorf("the slow client is still subscribed")
+	}
+	close(buf.release)
+	if err := <-errc; err == nil {
+		t.Error("Serve of a slow client returned nil")
+	}
+}
@@ -2,10 +2,15 @@ package xweb
 
 import (
 	"crypto/md5"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
+	"strings"
 	"sync"
 
 	"github.com/howeyc/fsnotify"
@@ -16,6 +21,7 @@ type StaticVerMgr struct {
 	mutex   *sync.Mutex
 	Path    string
 	Ignores map[string]bool
+	FS      fs.FS // the static files, DiskFS(Path) when nil
 	app     *App
 }
 
@@ -99,8 +105,21 @@ func (self *StaticVerMgr) Init(app *App, staticPath string) error {
 	self.mutex = &sync.Mutex{}
 	self.Ignores = map[string]bool{".DS_Store": true}
 	self.app = app
+	if self.FS == nil {
+		self.FS = app.staticFS()
+	}
 
-	if dirExists(staticPath) {
+	if manifest := app.AppConfig.StaticManifest; manifest != "" {
+		err := self.LoadManifest(manifest)
+		if err == nil {
+			return nil
+		}
+		app.Warnf("load static manifest %v failed: %v", manifest, err)
+	}
+
+	if _, onDisk := isDiskFS(self.FS); !onDisk {
+		self.CacheAll(staticPath)
+	} else if dirExists(staticPath) {
 		self.CacheAll(staticPath)
 
 		go self.Moniter(staticPath)
@@ -110,26 +129,12 @@ func (self *StaticVerMgr) Init(app *App, staticPath string) error {
 }
 
 func (self *StaticVerMgr) getFileVer(url string) string {
-	//content, err := ioutil.ReadFile(path.Join(self.Path, url))
-	fPath := filepath.Join(self.Path, url)
-	self.app.Debug("loaded static ", fPath)
-	f, err := os.Open(fPath)
-	if err != nil {
-		return ""
-	}
-	defer f.Close()
-
-	fInfo, err := f.Stat()
-	if err != nil {
-		return ""
-	}
-
-	content := make([]byte, int(fInfo.Size()))
-	_, err = f.Read(content)
+	self.app.Debug("loaded static ", url)
+	content, err := fs.ReadFile(self.FS, fsName(url))
 	if err == nil {
 		h := md5.New()
 		io.WriteString(h, string(content))
-		return fmt.Sprintf("%x", h.Sum(nil))[0:4]
+		return fmt.Sprintf("%x", h.Sum(nil))[0:8]
 	}
 	return ""
 }
@@ -138,11 +143,13 @@ func (self *StaticVerMgr) CacheAll(staticPath string) error {
 	self.mutex.Lock()
 	defer self.mutex.Unlock()
 	//fmt.Print("Getting static file version number, please wait... ")
-	err := filepath.Walk(staticPath, func(f string, info os.FileInfo, err error) error {
-		if info.IsDir() {
+	err := fs.WalkDir(self.FS, ".", func(rp string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
 			return nil
 		}
-		rp := f[len(staticPath)+1:]
 		if _, ok := self.Ignores[filepath.Base(rp)]; !ok {
 			self.Caches[rp] = self.getFileVer(rp)
 		}
@@ -170,6 +177,7 @@ func (self *StaticVerMgr) CacheDelete(url string) {
 	self.mutex.Lock()
 	defer self.mutex.Unlock()
 	delete(self.Caches, url)
+	self.app.AssetMgr.Changed(url)
 	self.app.Infof("static file %s is deleted.\n", url)
 }
 
@@ -181,5 +189,101 @@ func (self *StaticVerMgr) CacheItem(url string) {
 		defer self.mutex.Unlock()
 		self.Caches[url] = ver
 		self.app.Infof("static file %s is created.", url)
+		self.app.AssetMgr.Changed(url)
+	}
+}
+
+// fingerprintName inserts the version of a static file before its
+// extension, e.g. js/app.3f9a1c2b.js.
+func fingerprintName(url, ver string) string {
+	ext := path.Ext(url)
+	if strings.Contains(ext, "/") {
+		ext = ""
+	}
+	return url[:len(url)-len(ext)] + "." + ver + ext
+}
+
+var fingerprintRegexp = regexp.MustCompile(`^(.+)\.([0-9a-f]{8})(\.[^./]*)?$`)
+
+// parseFingerprint splits a fingerprinted name into the original name
+// and the version.
+func parseFingerprint(name string) (url, ver string, ok bool) {
+	m := fingerprintRegexp.FindStringSubmatch(name)
+	if m == nil {
+		return "", "", false
+	}
+	return m[1] + m[3], m[2], true
+}
+
+// Unfingerprint returns the static file of a fingerprinted name, if its
+// version is the current one.
+func (self *StaticVerMgr) Unfingerprint(name string) (string, bool) {
+	url, ver, ok := parseFingerprint(name)
+	if !ok || self.GetVersion(url) != ver {
+		return "", false
+	}
+	return url, true
+}
+
+// ExportManifest writes the JSON object mapping the static files to
+// their fingerprinted names, e.g. {"js/app.js": "js/app.3f9a1c2b.js"}.
+func (self *StaticVerMgr) ExportManifest(w io.Writer) error {
+	self.mutex.Lock()
+	manifest := make(map[string]string, len(self.Caches))
+	for url, ver := range self.Caches {
+		if ver != "" {
+			manifest[url] = fingerprintName(url, ver)
+		}
+	}
+	self.mutex.Unlock()
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(manifest)
+}
+
+// ImportManifest loads the versions of the static files from a manifest
+// written by ExportManifest or by a build pipeline, so that they don't
+// need to be computed.
+func (self *StaticVerMgr) ImportManifest(r io.Reader) error {
+	var manifest map[string]string
+	if err := json.NewDecoder(r).Decode(&manifest); err != nil {
+		return err
 	}
+	caches := make(map[string]string, len(manifest))
+	for url, name := range manifest {
+		orig, ver, ok := parseFingerprint(name)
+		if !ok || orig != url {
+			return fmt.Errorf("manifest entry %v: %v is not a fingerprinted name of it", url, name)
+		}
+		caches[url] = ver
+	}
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	for url, ver := range caches {
+		self.Caches[url] = ver
+	}
+	return nil
+}
+
+// SaveManifest exports the manifest to file.
+func (self *StaticVerMgr) SaveManifest(file string) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	if err = self.ExportManifest(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// LoadManifest imports the manifest of file.
+func (self *StaticVerMgr) LoadManifest(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return self.ImportManifest(f)
 }
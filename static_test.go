@@ -0,0 +1,55 @@
+package xweb
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFingerprintName(t *testing.T) {
+	tests := map[string]string{
+		"js/app.js":     "js/app.3f9a1c2b.js",
+		"css/a.min.css": "css/a.min.3f9a1c2b.css",
+		"LICENSE":       "LICENSE.3f9a1c2b",
+		"v1.2/README":   "v1.2/README.3f9a1c2b",
+	}
+	for url, want := range tests {
+		name := fingerprintName(url, "3f9a1c2b")
+		if name != want {
+			t.Errorf("fingerprintName(%q) = %q, want %q", url, name, want)
+		}
+		orig, ver, ok := parseFingerprint(name)
+		if !ok || orig != url || ver != "3f9a1c2b" {
+			t.Errorf("parseFingerprint(%q) = %q, %q, %v", name, orig, ver, ok)
+		}
+	}
+	if _, _, ok := parseFingerprint("js/app.js"); ok {
+		t.Error("a plain name was parsed as fingerprinted")
+	}
+}
+
+func TestStaticManifest(t *testing.T) {
+	mgr := &StaticVerMgr{
+		Caches: map[string]string{"js/app.js": "3f9a1c2b", "css/app.css": "0a1b2c3d"},
+		mutex:  &sync.Mutex{},
+	}
+	var buf bytes.Buffer
+	if err := mgr.ExportManifest(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `"js/app.js": "js/app.3f9a1c2b.js"`) {
+		t.Errorf("unexpected manifest %s", buf.String())
+	}
+
+	imported := &StaticVerMgr{Caches: map[string]string{}, mutex: &sync.Mutex{}}
+	if err := imported.ImportManifest(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if imported.Caches["css/app.css"] != "0a1b2c3d" || len(imported.Caches) != 2 {
+		t.Errorf("unexpected versions %v", imported.Caches)
+	}
+	if err := imported.ImportManifest(strings.NewReader(`{"a.js": "b.3f9a1c2b.js"}`)); err == nil {
+		t.Error("a name of another file should be rejected")
+	}
+}
@@ -0,0 +1,201 @@
+package xweb
+
+import (
+	"encoding/json"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StaticPolicy controls how the static files of an App are served.
+type StaticPolicy struct {
+	// Deny are path.Match patterns of the file and directory names
+	// never served, e.g. ".*" for the dotfiles, or of whole paths when
+	// they contain a slash, e.g. "config/*.yml".
+	Deny []string
+	// Allow are the names or paths served even if they match Deny.
+	Allow []string
+	// AutoIndex lists the directories without an index.html, as JSON
+	// when the client prefers it to HTML.
+	AutoIndex bool
+	// CacheControl maps file extensions, e.g. ".js", or "*" for the
+	// other files, to a Cache-Control header. An Expires header is
+	// derived from its max-age.
+	CacheControl map[string]string
+	// MimeTypes maps file extensions to the Content-Type they are
+	// served with, overriding the system types.
+	MimeTypes map[string]string
+	// SpaPrefix enables the single-page application fallback: the GET
+	// requests under this prefix matching no route and no file are
+	// answered with SpaIndex, path.Join(SpaPrefix, "index.html") by
+	// default.
+	SpaPrefix string
+	SpaIndex  string
+}
+
+// DefaultStaticPolicy denies the dotfiles but .well-known.
+func DefaultStaticPolicy() *StaticPolicy {
+	return &StaticPolicy{
+		Deny:  []string{".*"},
+		Allow: []string{".well-known"},
+	}
+}
+
+func (a *App) staticPolicy() *StaticPolicy {
+	if a.AppConfig.StaticPolicy != nil {
+		return a.AppConfig.StaticPolicy
+	}
+	return DefaultStaticPolicy()
+}
+
+func matchStaticPatterns(patterns []string, name string, segments []string) bool {
+	for _, pattern := range patterns {
+		if strings.Contains(pattern, "/") {
+			if ok, _ := path.Match(strings.TrimPrefix(pattern, "/"), name); ok {
+				return true
+			}
+			continue
+		}
+		for _, segment := range segments {
+			if ok, _ := path.Match(pattern, segment); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Denied reports whether the static file name, a fs.FS path, must not
+// be served.
+func (p *StaticPolicy) Denied(name string) bool {
+	if name == "." {
+		return false
+	}
+	segments := strings.Split(name, "/")
+	return matchStaticPatterns(p.Deny, name, segments) &&
+		!matchStaticPatterns(p.Allow, name, segments)
+}
+
+var maxAgeRegexp = regexp.MustCompile(`(?i)(?:^|[,\s])max-age=(\d+)`)
+
+// setHeaders sets the Cache-Control, Expires and Content-Type headers
+// of the static file name.
+func (p *StaticPolicy) setHeaders(h http.Header, name string) {
+	ext := strings.ToLower(path.Ext(name))
+	cc, ok := p.CacheControl[ext]
+	if !ok {
+		cc = p.CacheControl["*"]
+	}
+	if cc != "" {
+		h.Set("Cache-Control", cc)
+		if m := maxAgeRegexp.FindStringSubmatch(cc); m != nil {
+			if age, err := strconv.Atoi(m[1]); err == nil {
+				h.Set("Expires", webTime(time.Now().UTC().Add(time.Duration(age)*time.Second)))
+			}
+		}
+	}
+	if ctype, ok := p.MimeTypes[ext]; ok {
+		h.Set("Content-Type", ctype)
+	}
+}
+
+type dirEntry struct {
+	Name    string    `json:"name"`
+	IsDir   bool      `json:"isDir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+var dirIndexTmpl = template.Must(template.New("dirindex").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}<tr><td><a href="{{.Name}}{{if .IsDir}}/{{end}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td>{{if not .IsDir}}{{.Size}}{{end}}</td><td>{{.ModTime.Format "2006-01-02 15:04"}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// serveDirIndex lists the static directory of requestPath when the
+// policy's AutoIndex is set.
+func (a *App) serveDirIndex(requestPath string, req *http.Request, w http.ResponseWriter) bool {
+	policy := a.staticPolicy()
+	if !policy.AutoIndex {
+		return false
+	}
+	newPath := requestPath
+	if strings.HasPrefix(newPath, a.BasePath) {
+		newPath = newPath[len(a.BasePath):]
+	}
+	fsys := a.staticFS()
+	name := fsName(newPath)
+	if policy.Denied(name) {
+		return false
+	}
+	finfo, err := fs.Stat(fsys, name)
+	if err != nil || !finfo.IsDir() {
+		return false
+	}
+	if !strings.HasSuffix(requestPath, "/") {
+		// the relative links need the trailing slash
+		http.Redirect(w, req, requestPath+"/", http.StatusMovedPermanently)
+		return true
+	}
+	dirEntries, err := fs.ReadDir(fsys, name)
+	if err != nil {
+		return false
+	}
+
+	entries := make([]dirEntry, 0, len(dirEntries))
+	for _, de := range dirEntries {
+		if policy.Denied(path.Join(name, de.Name())) {
+			continue
+		}
+		info, err := de.Info()
+		if err != nil {
+			continue
+		}
+		entries = append(entries, dirEntry{de.Name(), de.IsDir(), info.Size(), info.ModTime()})
+	}
+
+	addVary(w.Header(), "Accept")
+	if negotiate(req.Header.Get("Accept"), []string{"text/html", "application/json"}) == "application/json" {
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(entries)
+		return true
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := dirIndexTmpl.Execute(w, map[string]interface{}{"Path": requestPath, "Entries": entries}); err != nil {
+		a.Error(err)
+	}
+	return true
+}
+
+// underPathPrefix reports whether p is the path prefix or is under it,
+// /app matching /app and /app/users but not /apple.
+func underPathPrefix(p, prefix string) bool {
+	prefix = strings.TrimSuffix(prefix, "/")
+	return p == prefix || strings.HasPrefix(p, prefix+"/")
+}
+
+// serveSpaIndex answers the GET requests under the policy's SpaPrefix
+// with the application's index file.
+func (a *App) serveSpaIndex(requestPath string, req *http.Request, w http.ResponseWriter) bool {
+	policy := a.staticPolicy()
+	if policy.SpaPrefix == "" || !underPathPrefix(requestPath, policy.SpaPrefix) {
+		return false
+	}
+	index := policy.SpaIndex
+	if index == "" {
+		index = path.Join(policy.SpaPrefix, "index.html")
+	}
+	return a.TryServingFile(index, req, w)
+}
@@ -0,0 +1,106 @@
+package xweb
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+
+	"github.com/go-xweb/log"
+)
+
+func TestStaticPolicyDenied(t *testing.T) {
+	p := DefaultStaticPolicy()
+	p.Deny = append(p.Deny, "config/*.yml")
+	tests := map[string]bool{
+		".env":                     true,
+		".git/config":              true,
+		"css/.hidden/app.css":      true,
+		".well-known/security.txt": false,
+		"css/app.css":              false,
+		"config/db.yml":            true,
+		"assets/config/db.yml":     false,
+		".":                        false,
+	}
+	for name, denied := range tests {
+		if d := p.Denied(name); d != denied {
+			t.Errorf("Denied(%q) = %v, want %v", name, d, denied)
+		}
+	}
+}
+
+func TestStaticPolicyHeaders(t *testing.T) {
+	p := &StaticPolicy{
+		CacheControl: map[string]string{
+			".js": "public, max-age=3600",
+			"*":   "no-cache",
+		},
+		MimeTypes: map[string]string{".wasm": "application/wasm"},
+	}
+	h := http.Header{}
+	p.setHeaders(h, "js/app.JS")
+	if h.Get("Cache-Control") != "public, max-age=3600" || h.Get("Expires") == "" {
+		t.Errorf("unexpected headers %v", h)
+	}
+	h = http.Header{}
+	p.setHeaders(h, "app.wasm")
+	if h.Get("Cache-Control") != "no-cache" || h.Get("Expires") != "" || h.Get("Content-Type") != "application/wasm" {
+		t.Errorf("unexpected headers %v", h)
+	}
+}
+
+func TestStaticPolicyFingerprint(t *testing.T) {
+	s := NewServer("staticfingerprint")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	app := s.RootApp
+	app.AppConfig.StaticFileVersion = true
+	app.AppConfig.StaticFingerprint = true
+	app.AppConfig.StaticFS = fstest.MapFS{
+		"app.js":     {Data: []byte("app")},
+		"secret.txt": {Data: []byte("secret")},
+	}
+	app.AppConfig.StaticPolicy.Deny = append(app.AppConfig.StaticPolicy.Deny, "secret.txt")
+	s.initServer()
+
+	tests := map[string]int{
+		"/app.js": 200,
+		"/app." + app.StaticVerMgr.GetVersion("app.js") + ".js": 200,
+		"/secret.txt": 404,
+		"/secret." + app.StaticVerMgr.GetVersion("secret.txt") + ".txt": 404,
+	}
+	for path, status := range tests {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != status {
+			t.Errorf("GET %v = %v, want %v", path, w.Code, status)
+		}
+	}
+}
+
+func TestStaticPolicySpa(t *testing.T) {
+	s := NewServer("staticspa")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	app := s.RootApp
+	app.AppConfig.StaticFS = fstest.MapFS{
+		"app/index.html": {Data: []byte("spa")},
+	}
+	app.AppConfig.StaticPolicy.SpaPrefix = "/app"
+	s.initServer()
+
+	tests := map[string]int{
+		"/app":          200,
+		"/app/":         200,
+		"/app/users/42": 200,
+		"/apple":        404,
+		"/application/": 404,
+		"/other":        404,
+	}
+	for path, status := range tests {
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		if w.Code != status {
+			t.Errorf("GET %v = %v, want %v", path, w.Code, status)
+		}
+	}
+}
@@ -44,6 +44,8 @@ var statusText = map[int]string{
 	http.StatusUnsupportedMediaType:         "Unsupported Media Type",
 	http.StatusRequestedRangeNotSatisfiable: "Requested Range Not Satisfiable",
 	http.StatusExpectationFailed:            "Expectation Failed",
+	http.StatusUnprocessableEntity:          "Unprocessable Entity",
+	http.StatusUpgradeRequired:              "Upgrade Required",
 
 	http.StatusInternalServerError:     "Internal Server Error",
 	http.StatusNotImplemented:          "Not Implemented",
@@ -3,6 +3,7 @@ package xweb
 import (
 	"fmt"
 	"html/template"
+	"io/fs"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -212,17 +213,35 @@ var (
 		"IsNil":      IsNil,
 		"UrlFor":     UrlFor,
 		"Js":         Js,
+		"layout":     layoutFunc,
 	}
 )
 
+func copyFuncMap(funcs template.FuncMap) template.FuncMap {
+	m := make(template.FuncMap, len(funcs))
+	for k, v := range funcs {
+		m[k] = v
+	}
+	return m
+}
+
 type TemplateMgr struct {
 	Caches       map[string][]byte
 	mutex        *sync.Mutex
 	RootDir      string
 	Ignores      map[string]bool
 	IsReload     bool
+	FS           fs.FS // the templates, DiskFS(RootDir) when nil
 	app          *App
 	Preprocessor func([]byte) []byte
+	parsed       map[string]*parsedTemplate
+}
+
+// parsedTemplate is a compiled template set, with the contents of the
+// templates it was parsed from.
+type parsedTemplate struct {
+	contents []string
+	set      TemplateSet
 }
 
 func (self *TemplateMgr) Moniter(rootDir string) error {
@@ -316,20 +335,20 @@ func (self *TemplateMgr) CacheAll(rootDir string) error {
 	self.mutex.Lock()
 	defer self.mutex.Unlock()
 	//fmt.Print("Reading the contents of the template files, please wait... ")
-	err := filepath.Walk(rootDir, func(f string, info os.FileInfo, err error) error {
-		if info.IsDir() {
+	err := fs.WalkDir(self.FS, ".", func(tmpl string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
 			return nil
 		}
-		tmpl := f[len(rootDir)+1:]
-		tmpl = strings.Replace(tmpl, "\\", "/", -1) //[SWH|+]fix windows env
 		if _, ok := self.Ignores[filepath.Base(tmpl)]; !ok {
-			fpath := filepath.Join(self.RootDir, tmpl)
-			content, err := ioutil.ReadFile(fpath)
+			content, err := fs.ReadFile(self.FS, tmpl)
 			if err != nil {
-				self.app.Debugf("load template %s error: %v", fpath, err)
+				self.app.Debugf("load template %s error: %v", tmpl, err)
 				return err
 			}
-			self.app.Debug("loaded template", fpath)
+			self.app.Debug("loaded template", tmpl)
 			self.Caches[tmpl] = content
 		}
 		return nil
@@ -343,8 +362,15 @@ func (self *TemplateMgr) Init(app *App, rootDir string, reload bool) error {
 	self.Caches = make(map[string][]byte)
 	self.Ignores = make(map[string]bool)
 	self.mutex = &sync.Mutex{}
+	self.parsed = make(map[string]*parsedTemplate)
 	self.app = app
-	if dirExists(rootDir) {
+	if self.FS == nil {
+		self.FS = app.templateFS()
+	}
+	if _, onDisk := isDiskFS(self.FS); !onDisk {
+		// only the files of the disk can change
+		self.CacheAll(rootDir)
+	} else if dirExists(rootDir) {
 		self.CacheAll(rootDir)
 
 		if reload {
@@ -367,7 +393,7 @@ func (self *TemplateMgr) GetTemplate(tmpl string) ([]byte, error) {
 		return content, nil
 	}
 
-	content, err := ioutil.ReadFile(filepath.Join(self.RootDir, tmpl))
+	content, err := fs.ReadFile(self.FS, fsName(tmpl))
 	if err == nil {
 		self.app.Debugf("load template %v from the file:", tmpl)
 		self.Caches[tmpl] = content
@@ -384,6 +410,8 @@ func (self *TemplateMgr) CacheTemplate(tmpl string, content []byte) {
 	tmpl = strings.Replace(tmpl, "\\", "/", -1)
 	self.app.Debugf("update template %v on cache", tmpl)
 	self.Caches[tmpl] = content
+	// a template set also holds the layouts and blocks of the others
+	self.parsed = make(map[string]*parsedTemplate)
 	return
 }
 
@@ -393,5 +421,31 @@ func (self *TemplateMgr) CacheDelete(tmpl string) {
 	tmpl = strings.Replace(tmpl, "\\", "/", -1)
 	self.app.Debugf("delete template %v from cache", tmpl)
 	delete(self.Caches, tmpl)
+	self.parsed = make(map[string]*parsedTemplate)
 	return
 }
+
+// GetParsed returns the compiled template set of key, if it was parsed
+// from the same contents.
+func (self *TemplateMgr) GetParsed(key string, contents []string) (TemplateSet, bool) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	p, ok := self.parsed[key]
+	if !ok || len(p.contents) != len(contents) {
+		return nil, false
+	}
+	for i, content := range contents {
+		if p.contents[i] != content {
+			return nil, false
+		}
+	}
+	return p.set, true
+}
+
+// CacheParsed keeps the compiled template set of key until one of the
+// template files changes.
+func (self *TemplateMgr) CacheParsed(key string, contents []string, set TemplateSet) {
+	self.mutex.Lock()
+	defer self.mutex.Unlock()
+	self.parsed[key] = &parsedTemplate{contents, set}
+}
@@ -1,6 +1,13 @@
 package xweb
 
-import "testing"
+import (
+	"html/template"
+	"io/ioutil"
+	"sync"
+	"testing"
+
+	"github.com/go-xweb/log"
+)
 
 func TestIsNil(t *testing.T) {
 	if !IsNil(nil) {
@@ -42,3 +49,24 @@ func TestIsNil(t *testing.T) {
 		t.Error("c")
 	}
 }
+
+func TestTemplateMgrParsed(t *testing.T) {
+	mgr := &TemplateMgr{
+		Caches: map[string][]byte{},
+		mutex:  &sync.Mutex{},
+		parsed: map[string]*parsedTemplate{},
+		app:    &App{Logger: log.New(ioutil.Discard, "", log.Ldefault())},
+	}
+	tmpl := template.Must(template.New("a.html").Parse("a"))
+	mgr.CacheParsed("a.html", []string{"a"}, htmlTemplateSet{tmpl})
+	if got, ok := mgr.GetParsed("a.html", []string{"a"}); !ok || got.(htmlTemplateSet).Template != tmpl {
+		t.Error("the parsed template should be cached")
+	}
+	if _, ok := mgr.GetParsed("a.html", []string{"b"}); ok {
+		t.Error("a template of another content should be parsed again")
+	}
+	mgr.CacheDelete("b.html")
+	if _, ok := mgr.GetParsed("a.html", []string{"a"}); ok {
+		t.Error("a template change should drop the parsed templates")
+	}
+}
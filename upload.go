@@ -0,0 +1,90 @@
+package xweb
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+)
+
+// UploadReader iterates over the parts of a multipart request body
+// as they arrive on the wire, without buffering them to memory or to
+// temp files. It's used by routes tagged with the stream option.
+type UploadReader struct {
+	*multipart.Reader
+
+	// OnProgress, if set, is called each time a chunk of the body has
+	// been read. total is the request's Content-Length or -1 if unknown.
+	OnProgress func(read, total int64)
+
+	counter *countingReader
+}
+
+// BytesRead returns the number of body bytes consumed so far.
+func (r *UploadReader) BytesRead() int64 {
+	return r.counter.n
+}
+
+// Each calls fn for every part of the body until the body is exhausted
+// or fn returns an error. The part is closed after fn returns.
+func (r *UploadReader) Each(fn func(*multipart.Part) error) error {
+	for {
+		part, err := r.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		err = fn(part)
+		part.Close()
+		if err != nil {
+			return err
+		}
+	}
+}
+
+type countingReader struct {
+	io.ReadCloser
+	n     int64
+	total int64
+	r     *UploadReader
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	if n > 0 {
+		c.n += int64(n)
+		if c.r.OnProgress != nil {
+			c.r.OnProgress(c.n, c.total)
+		}
+	}
+	return n, err
+}
+
+// MultipartReader returns an UploadReader over the request body. The
+// body is limited to maxSize bytes, or AppConfig.MaxUploadSize when
+// maxSize is omitted; reading past the limit fails with an error and
+// the connection is closed after the response.
+// It must be used on routes tagged with the stream option, e.g.
+// `xweb:"POST /upload stream"`, since otherwise the body has already
+// been consumed by ParseMultipartForm.
+func (c *Action) MultipartReader(maxSize ...int64) (*UploadReader, error) {
+	limit := c.App.AppConfig.MaxUploadSize
+	if len(maxSize) > 0 {
+		limit = maxSize[0]
+	}
+	if limit > 0 {
+		c.Request.Body = http.MaxBytesReader(c.ResponseWriter, c.Request.Body, limit)
+	}
+
+	ur := &UploadReader{}
+	ur.counter = &countingReader{ReadCloser: c.Request.Body, total: c.Request.ContentLength, r: ur}
+	c.Request.Body = ur.counter
+
+	mr, err := c.Request.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	ur.Reader = mr
+	return ur, nil
+}
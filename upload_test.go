@@ -0,0 +1,107 @@
+package xweb
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-xweb/log"
+)
+
+type uploadAction struct {
+	*Action
+	upload Mapper `xweb:"POST /upload stream"`
+	small  Mapper `xweb:"POST /small stream"`
+
+	progress []int64
+	total    int64
+}
+
+func (c *uploadAction) Init() {
+	c.Option.CheckXsrf = false
+}
+
+func (c *uploadAction) read(maxSize ...int64) error {
+	// the query string is parsed, the body is left to the reader
+	name := c.Request.FormValue("name")
+	if c.Request.PostFormValue("file") != "" {
+		return InternalServerError("the body was parsed")
+	}
+	ur, err := c.MultipartReader(maxSize...)
+	if err != nil {
+		return err
+	}
+	ur.OnProgress = func(read, total int64) {
+		c.progress = append(c.progress, read)
+		c.total = total
+	}
+	parts := []string{name}
+	err = ur.Each(func(part *multipart.Part) error {
+		content, err := ioutil.ReadAll(part)
+		parts = append(parts, part.FormName()+"="+string(content))
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	if n := len(c.progress); n == 0 || c.progress[n-1] != ur.BytesRead() || c.total != c.Request.ContentLength {
+		return InternalServerError("progress was not reported")
+	}
+	return c.Write(strings.Join(parts, ","))
+}
+
+func (c *uploadAction) Upload() error {
+	return c.read()
+}
+
+func (c *uploadAction) Small() error {
+	return c.read(400)
+}
+
+func multipartBody(t *testing.T, fields map[string]string) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for name, value := range fields {
+		if err := mw.WriteField(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &body, mw.FormDataContentType()
+}
+
+func TestMultipartReader(t *testing.T) {
+	s := NewServer("upload")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.AddAction(&uploadAction{})
+	s.initServer()
+
+	post := func(path string, fields map[string]string) *httptest.ResponseRecorder {
+		body, ct := multipartBody(t, fields)
+		req := httptest.NewRequest("POST", path, body)
+		req.Header.Set("Content-Type", ct)
+		req.Header.Set("Accept", "text/plain")
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		return w
+	}
+
+	w := post("/upload?name=q", map[string]string{"file": "content"})
+	if w.Code != http.StatusOK || w.Body.String() != "q,file=content" {
+		t.Errorf("POST /upload = %v %q", w.Code, w.Body.String())
+	}
+	w = post("/small", map[string]string{"file": strings.Repeat("x", 1000)})
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST /small over the limit = %v %q, want 413", w.Code, w.Body.String())
+	}
+	w = post("/small", map[string]string{"f": "x"})
+	if w.Code != http.StatusOK || w.Body.String() != ",f=x" {
+		t.Errorf("POST /small = %v %q", w.Code, w.Body.String())
+	}
+}
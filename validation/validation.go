@@ -56,6 +56,9 @@ func (r *ValidationResult) Message(message string, args ...interface{}) *Validat
 type Validation struct {
 	Errors    []*ValidationError
 	ErrorsMap map[string]*ValidationError
+	// MessageTmpls replaces the global MessageTmpls for this context,
+	// e.g. to translate the messages of a request.
+	MessageTmpls map[string]string
 }
 
 func (v *Validation) Clear() {
@@ -185,12 +188,12 @@ func (v *Validation) apply(chk Validator, obj interface{}) *ValidationResult {
 	}
 
 	err := &ValidationError{
-		Message:    chk.DefaultMessage(),
+		Message:    v.message(chk),
 		Key:        key,
 		Name:       Name,
 		Field:      Field,
 		Value:      obj,
-		Tmpl:       MessageTmpls[Name],
+		Tmpl:       v.messageTmpl(Name),
 		LimitValue: chk.GetLimitValue(),
 	}
 	v.setError(err)
@@ -202,6 +205,29 @@ func (v *Validation) apply(chk Validator, obj interface{}) *ValidationResult {
 	}
 }
 
+func (v *Validation) messageTmpl(name string) string {
+	if v.MessageTmpls != nil {
+		return v.MessageTmpls[name]
+	}
+	return MessageTmpls[name]
+}
+
+// message returns the message of the failed validator chk, formatted
+// with the template of the context when it has one of its own.
+func (v *Validation) message(chk Validator) string {
+	if v.MessageTmpls == nil {
+		return chk.DefaultMessage()
+	}
+	tmpl, ok := v.MessageTmpls[reflect.Indirect(reflect.ValueOf(chk)).Type().Name()]
+	if !ok {
+		return chk.DefaultMessage()
+	}
+	if args := messageArgs(chk); len(args) > 0 {
+		return fmt.Sprintf(tmpl, args...)
+	}
+	return tmpl
+}
+
 func (v *Validation) setError(err *ValidationError) {
 	v.Errors = append(v.Errors, err)
 	if v.ErrorsMap == nil {
@@ -403,3 +403,13 @@ func TestValid(t *testing.T) {
 		t.Errorf("Message key should be `UserExt2.UserExt3.Domain|Match` but got %s", valid.Errors[0].Key)
 	}
 }
+
+func TestMessageTmpls(t *testing.T) {
+	valid := Validation{MessageTmpls: map[string]string{"Range": "entre %d et %d"}}
+	if r := valid.Range(12, 1, 10, "range"); r.Ok || r.Error.Message != "entre 1 et 10" {
+		t.Errorf("Range message = %q", r.Error.Message)
+	}
+	if r := valid.Required("", "name"); r.Ok || r.Error.Message != MessageTmpls["Required"] {
+		t.Errorf("Required message = %q", r.Error.Message)
+	}
+}
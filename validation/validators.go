@@ -31,6 +31,29 @@ var MessageTmpls = map[string]string{
 	"ZipCode":      "Must be valid zipcode",
 }
 
+// messageArgs returns the arguments of the message template of chk.
+func messageArgs(chk Validator) []interface{} {
+	switch c := chk.(type) {
+	case Min:
+		return []interface{}{c.Min}
+	case Max:
+		return []interface{}{c.Max}
+	case Range:
+		return []interface{}{c.Min.Min, c.Max.Max}
+	case MinSize:
+		return []interface{}{c.Min}
+	case MaxSize:
+		return []interface{}{c.Max}
+	case Length:
+		return []interface{}{c.N}
+	case Match:
+		return []interface{}{c.Regexp.String()}
+	case NoMatch:
+		return []interface{}{c.Regexp.String()}
+	}
+	return nil
+}
+
 type Validator interface {
 	IsSatisfied(interface{}) bool
 	DefaultMessage() string
@@ -0,0 +1,488 @@
+package xweb
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// WebSocket message types, as defined in RFC 6455.
+const (
+	TextMessage   = 1
+	BinaryMessage = 2
+	CloseMessage  = 8
+	PingMessage   = 9
+	PongMessage   = 10
+)
+
+// WebSocket close codes, as defined in RFC 6455.
+const (
+	CloseNormalClosure           = 1000
+	CloseGoingAway               = 1001
+	CloseProtocolError           = 1002
+	CloseUnsupportedData         = 1003
+	CloseNoStatusReceived        = 1005
+	CloseAbnormalClosure         = 1006
+	CloseInvalidFramePayloadData = 1007
+	ClosePolicyViolation         = 1008
+	CloseMessageTooBig           = 1009
+	CloseInternalServerErr       = 1011
+)
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+var ErrWebSocketClosed = errors.New("websocket: connection closed")
+
+// CloseError is returned by WebSocketConn.ReadMessage when the peer
+// closed the connection.
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	return fmt.Sprintf("websocket: closed %d %s", e.Code, e.Reason)
+}
+
+// WebSocketOptions configures the WebSocket routes of an App.
+type WebSocketOptions struct {
+	// MaxFrameSize is the largest frame payload accepted, larger frames
+	// close the connection with CloseMessageTooBig.
+	MaxFrameSize int64
+	// MaxMessageSize is the largest message accepted once its frames
+	// are reassembled.
+	MaxMessageSize int64
+	// Subprotocols are the subprotocols supported by the server, in
+	// order of preference.
+	Subprotocols []string
+	// CheckOrigin returns whether the upgrade request's origin is
+	// allowed. By default the origin's host must match the Host header.
+	CheckOrigin func(r *http.Request) bool
+}
+
+func defaultWebSocketOptions() *WebSocketOptions {
+	return &WebSocketOptions{
+		MaxFrameSize:   1 << 20,
+		MaxMessageSize: 4 << 20,
+	}
+}
+
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	return strings.EqualFold(u.Host, r.Host)
+}
+
+func headerContainsToken(h http.Header, name, token string) bool {
+	for _, v := range h[http.CanonicalHeaderKey(name)] {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isWebSocketUpgrade(r *http.Request) bool {
+	return r.Method == "GET" &&
+		headerContainsToken(r.Header, "Connection", "upgrade") &&
+		headerContainsToken(r.Header, "Upgrade", "websocket")
+}
+
+// WebSocketConn is a WebSocket connection given to the handlers of
+// routes tagged with the WS method, e.g. `xweb:"WS /chat"`:
+//
+//	func (c *ChatAction) Chat() error {
+//		ws := c.WebSocket()
+//		for {
+//			_, msg, err := ws.ReadMessage()
+//			if err != nil {
+//				return nil
+//			}
+//			ws.WriteText(string(msg))
+//		}
+//	}
+//
+// Reads must be done by a single goroutine, writes may be concurrent.
+type WebSocketConn struct {
+	conn        net.Conn
+	br          *bufio.Reader
+	opts        *WebSocketOptions
+	subprotocol string
+
+	writeMutex sync.Mutex
+	closeOnce  sync.Once
+	closed     bool
+
+	// PingHandler is called with the payload of received pings, after
+	// the pong reply was sent.
+	PingHandler func(data []byte)
+	// PongHandler is called with the payload of received pongs.
+	PongHandler func(data []byte)
+}
+
+// WebSocket returns the connection of a WebSocket route, nil for other
+// routes.
+func (c *Action) WebSocket() *WebSocketConn {
+	return c.webSocket
+}
+
+// upgradeWebSocket performs the RFC 6455 opening handshake and hijacks
+// the connection. The response headers already set, such as a session
+// cookie, are sent with the handshake response. The handshake errors
+// are AbortErrors with their status, e.g. 426 for another version.
+func (c *Action) upgradeWebSocket() (*WebSocketConn, error) {
+	req := c.Request
+	opts := c.App.WebSocketOptions
+	if opts == nil {
+		opts = defaultWebSocketOptions()
+	}
+
+	if !isWebSocketUpgrade(req) {
+		c.SetHeader("Upgrade", "websocket")
+		return nil, Abort(http.StatusUpgradeRequired, "websocket: not an upgrade request")
+	}
+	if req.Header.Get("Sec-Websocket-Version") != "13" {
+		c.SetHeader("Sec-WebSocket-Version", "13")
+		return nil, Abort(http.StatusUpgradeRequired, "websocket: unsupported version")
+	}
+	key := req.Header.Get("Sec-Websocket-Key")
+	if key == "" {
+		return nil, Abort(http.StatusBadRequest, "websocket: missing Sec-WebSocket-Key")
+	}
+	checkOrigin := opts.CheckOrigin
+	if checkOrigin == nil {
+		checkOrigin = sameOrigin
+	}
+	if !checkOrigin(req) {
+		return nil, Abort(http.StatusForbidden, "websocket: origin not allowed")
+	}
+
+	var subprotocol string
+	if len(opts.Subprotocols) > 0 {
+	find:
+		for _, p := range opts.Subprotocols {
+			for _, v := range req.Header["Sec-Websocket-Protocol"] {
+				for _, t := range strings.Split(v, ",") {
+					if strings.TrimSpace(t) == p {
+						subprotocol = p
+						break find
+					}
+				}
+			}
+		}
+	}
+
+	hijacker, ok := c.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("websocket: the ResponseWriter does not support hijacking")
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	accept := base64.StdEncoding.EncodeToString(h.Sum(nil))
+
+	header := c.ResponseWriter.Header()
+	header.Del("Content-Type")
+	header.Del("Content-Length")
+	header.Set("Upgrade", "websocket")
+	header.Set("Connection", "Upgrade")
+	header.Set("Sec-WebSocket-Accept", accept)
+	if subprotocol != "" {
+		header.Set("Sec-WebSocket-Protocol", subprotocol)
+	}
+
+	brw.WriteString("HTTP/1.1 101 Switching Protocols\r\n")
+	header.Write(brw)
+	brw.WriteString("\r\n")
+	if err = brw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	// the handshake isn't bound by the server's timeouts anymore
+	conn.SetDeadline(time.Time{})
+
+	return &WebSocketConn{
+		conn:        conn,
+		br:          brw.Reader,
+		opts:        opts,
+		subprotocol: subprotocol,
+	}, nil
+}
+
+// Subprotocol returns the negotiated subprotocol, if any.
+func (ws *WebSocketConn) Subprotocol() string {
+	return ws.subprotocol
+}
+
+// RemoteAddr returns the address of the client.
+func (ws *WebSocketConn) RemoteAddr() net.Addr {
+	return ws.conn.RemoteAddr()
+}
+
+// SetReadDeadline sets the deadline of the next reads.
+func (ws *WebSocketConn) SetReadDeadline(t time.Time) error {
+	return ws.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the deadline of the next writes.
+func (ws *WebSocketConn) SetWriteDeadline(t time.Time) error {
+	return ws.conn.SetWriteDeadline(t)
+}
+
+func (ws *WebSocketConn) writeFrame(opcode int, data []byte) error {
+	ws.writeMutex.Lock()
+	defer ws.writeMutex.Unlock()
+	if ws.closed {
+		return ErrWebSocketClosed
+	}
+
+	// server frames are never masked
+	header := make([]byte, 2, 10)
+	header[0] = 0x80 | byte(opcode)
+	switch n := len(data); {
+	case n <= 125:
+		header[1] = byte(n)
+	case n <= 0xffff:
+		header[1] = 126
+		header = header[:4]
+		binary.BigEndian.PutUint16(header[2:], uint16(n))
+	default:
+		header[1] = 127
+		header = header[:10]
+		binary.BigEndian.PutUint64(header[2:], uint64(n))
+	}
+	if _, err := ws.conn.Write(header); err != nil {
+		return err
+	}
+	_, err := ws.conn.Write(data)
+	if opcode == CloseMessage {
+		ws.closed = true
+	}
+	return err
+}
+
+// WriteMessage sends a TextMessage or a BinaryMessage.
+func (ws *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	if messageType != TextMessage && messageType != BinaryMessage {
+		return fmt.Errorf("websocket: invalid message type %d", messageType)
+	}
+	return ws.writeFrame(messageType, data)
+}
+
+// WriteText sends a text message.
+func (ws *WebSocketConn) WriteText(s string) error {
+	return ws.writeFrame(TextMessage, []byte(s))
+}
+
+// WriteBinary sends a binary message.
+func (ws *WebSocketConn) WriteBinary(data []byte) error {
+	return ws.writeFrame(BinaryMessage, data)
+}
+
+// WriteJSON sends v encoded as JSON in a text message.
+func (ws *WebSocketConn) WriteJSON(v interface{}) error {
+	content, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return ws.writeFrame(TextMessage, content)
+}
+
+// ReadJSON reads the next message and decodes it as JSON into v.
+func (ws *WebSocketConn) ReadJSON(v interface{}) error {
+	_, data, err := ws.ReadMessage()
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Ping sends a ping, the client answers with a pong given to
+// PongHandler.
+func (ws *WebSocketConn) Ping(data []byte) error {
+	if len(data) > 125 {
+		return errors.New("websocket: control frame payload too large")
+	}
+	return ws.writeFrame(PingMessage, data)
+}
+
+// Close sends a close frame with code and reason and closes the
+// connection. It's called with CloseNormalClosure once the handler
+// returns.
+func (ws *WebSocketConn) Close(code int, reason string) error {
+	var err error
+	ws.closeOnce.Do(func() {
+		var payload []byte
+		if code != CloseNoStatusReceived {
+			payload = make([]byte, 2, 2+len(reason))
+			binary.BigEndian.PutUint16(payload, uint16(code))
+			payload = append(payload, reason...)
+			if len(payload) > 125 {
+				payload = payload[:125]
+			}
+		}
+		// an abnormal closure is never sent, the connection just drops
+		if code != CloseAbnormalClosure {
+			ws.conn.SetWriteDeadline(time.Now().Add(5 * time.Second))
+			err = ws.writeFrame(CloseMessage, payload)
+		}
+		ws.writeMutex.Lock()
+		ws.closed = true
+		ws.writeMutex.Unlock()
+		if e := ws.conn.Close(); err == nil {
+			err = e
+		}
+	})
+	return err
+}
+
+type wsFrame struct {
+	fin     bool
+	opcode  int
+	payload []byte
+}
+
+func (ws *WebSocketConn) readFrame() (*wsFrame, error) {
+	var head [2]byte
+	if _, err := io.ReadFull(ws.br, head[:]); err != nil {
+		return nil, err
+	}
+	f := &wsFrame{fin: head[0]&0x80 != 0, opcode: int(head[0] & 0x0f)}
+	if head[0]&0x70 != 0 {
+		return nil, &CloseError{CloseProtocolError, "reserved bits set"}
+	}
+	if head[1]&0x80 == 0 {
+		return nil, &CloseError{CloseProtocolError, "client frames must be masked"}
+	}
+
+	length := int64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var b [2]byte
+		if _, err := io.ReadFull(ws.br, b[:]); err != nil {
+			return nil, err
+		}
+		length = int64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err := io.ReadFull(ws.br, b[:]); err != nil {
+			return nil, err
+		}
+		length = int64(binary.BigEndian.Uint64(b[:]))
+		if length < 0 {
+			return nil, &CloseError{CloseProtocolError, "invalid length"}
+		}
+	}
+
+	if f.opcode >= CloseMessage {
+		if length > 125 || !f.fin {
+			return nil, &CloseError{CloseProtocolError, "invalid control frame"}
+		}
+	} else if ws.opts.MaxFrameSize > 0 && length > ws.opts.MaxFrameSize {
+		return nil, &CloseError{CloseMessageTooBig, "frame too large"}
+	}
+
+	var mask [4]byte
+	if _, err := io.ReadFull(ws.br, mask[:]); err != nil {
+		return nil, err
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(ws.br, f.payload); err != nil {
+		return nil, err
+	}
+	for i := range f.payload {
+		f.payload[i] ^= mask[i%4]
+	}
+	return f, nil
+}
+
+// ReadMessage returns the next text or binary message. Pings are
+// answered and pongs given to the handlers meanwhile. When the client
+// closes the connection, the close is acknowledged and a *CloseError
+// is returned.
+func (ws *WebSocketConn) ReadMessage() (messageType int, data []byte, err error) {
+	defer func() {
+		if ce, ok := err.(*CloseError); ok && ce.Code != CloseNormalClosure && ce.Code != CloseGoingAway {
+			ws.Close(ce.Code, ce.Reason)
+		} else if err != nil && !ok {
+			ws.Close(CloseAbnormalClosure, "")
+		}
+	}()
+
+	for {
+		f, err := ws.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		switch f.opcode {
+		case PingMessage:
+			if err = ws.writeFrame(PongMessage, f.payload); err != nil {
+				return 0, nil, err
+			}
+			if ws.PingHandler != nil {
+				ws.PingHandler(f.payload)
+			}
+			continue
+		case PongMessage:
+			if ws.PongHandler != nil {
+				ws.PongHandler(f.payload)
+			}
+			continue
+		case CloseMessage:
+			ce := &CloseError{Code: CloseNoStatusReceived}
+			if len(f.payload) >= 2 {
+				ce.Code = int(binary.BigEndian.Uint16(f.payload))
+				ce.Reason = string(f.payload[2:])
+			}
+			ws.Close(ce.Code, "")
+			return 0, nil, ce
+		case TextMessage, BinaryMessage:
+			if messageType != 0 {
+				return 0, nil, &CloseError{CloseProtocolError, "expected a continuation frame"}
+			}
+			messageType = f.opcode
+		case 0:
+			if messageType == 0 {
+				return 0, nil, &CloseError{CloseProtocolError, "unexpected continuation frame"}
+			}
+		default:
+			return 0, nil, &CloseError{CloseProtocolError, "unknown opcode"}
+		}
+
+		data = append(data, f.payload...)
+		if ws.opts.MaxMessageSize > 0 && int64(len(data)) > ws.opts.MaxMessageSize {
+			return 0, nil, &CloseError{CloseMessageTooBig, "message too large"}
+		}
+		if f.fin {
+			if messageType == TextMessage && !utf8.Valid(data) {
+				return 0, nil, &CloseError{CloseInvalidFramePayloadData, "invalid utf-8"}
+			}
+			return messageType, data, nil
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package xweb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-xweb/log"
+)
+
+type webSocketAction struct {
+	*Action
+	echo Mapper `xweb:"WS /echo"`
+}
+
+func (c *webSocketAction) Echo() error {
+	ws := c.WebSocket()
+	ws.PongHandler = func(data []byte) {
+		ws.WriteText("pong:" + string(data))
+	}
+	for {
+		messageType, msg, err := ws.ReadMessage()
+		if err != nil {
+			return nil
+		}
+		if string(msg) == "ping me" {
+			ws.Ping([]byte("p"))
+			continue
+		}
+		ws.WriteMessage(messageType, msg)
+	}
+}
+
+func newWebSocketServer(t *testing.T) *httptest.Server {
+	s := NewServer("websocket")
+	s.SetLogger(log.New(ioutil.Discard, "", log.Ldefault()))
+	s.RootApp.WebSocketOptions = &WebSocketOptions{MaxFrameSize: 64, MaxMessageSize: 128}
+	s.AddAction(&webSocketAction{})
+	s.initServer()
+	return httptest.NewServer(s)
+}
+
+// wsClient is the client side of a test connection.
+type wsClient struct {
+	t    *testing.T
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+func dialWebSocket(t *testing.T, srv *httptest.Server, key string) (*wsClient, *http.Response) {
+	conn, err := net.Dial("tcp", strings.TrimPrefix(srv.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	io.WriteString(conn, "GET /echo HTTP/1.1\r\nHost: "+strings.TrimPrefix(srv.URL, "http://")+
+		"\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Version: 13\r\n"+
+		"Sec-WebSocket-Key: "+key+"\r\n\r\n")
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		t.Fatalf("handshake = %v", resp.Status)
+	}
+	return &wsClient{t, conn, br}, resp
+}
+
+func (c *wsClient) write(fin bool, opcode int, payload []byte, masked bool) {
+	b0 := byte(opcode)
+	if fin {
+		b0 |= 0x80
+	}
+	frame := []byte{b0, 0}
+	switch n := len(payload); {
+	case n <= 125:
+		frame[1] = byte(n)
+	default:
+		frame[1] = 126
+		frame = append(frame, byte(n>>8), byte(n))
+	}
+	if masked {
+		frame[1] |= 0x80
+		mask := []byte{1, 2, 3, 4}
+		frame = append(frame, mask...)
+		for i, b := range payload {
+			frame = append(frame, b^mask[i%4])
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func (c *wsClient) read() (int, []byte) {
+	var head [2]byte
+	if _, err := io.ReadFull(c.br, head[:]); err != nil {
+		c.t.Fatal(err)
+	}
+	if head[1]&0x80 != 0 {
+		c.t.Fatal("server frames must not be masked")
+	}
+	length := int(head[1] & 0x7f)
+	if length == 126 {
+		var b [2]byte
+		io.ReadFull(c.br, b[:])
+		length = int(binary.BigEndian.Uint16(b[:]))
+	}
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(c.br, payload); err != nil {
+		c.t.Fatal(err)
+	}
+	return int(head[0] & 0x0f), payload
+}
+
+// expectClose reads the close frame of the server and returns its code.
+func (c *wsClient) expectClose() int {
+	opcode, payload := c.read()
+	if opcode != CloseMessage || len(payload) < 2 {
+		c.t.Fatalf("got opcode %v %q, want a close frame", opcode, payload)
+	}
+	return int(binary.BigEndian.Uint16(payload))
+}
+
+func TestWebSocketHandshake(t *testing.T) {
+	srv := newWebSocketServer(t)
+	defer srv.Close()
+
+	// the example of RFC 6455
+	c, resp := dialWebSocket(t, srv, "dGhlIHNhbXBsZSBub25jZQ==")
+	defer c.conn.Close()
+	if got := resp.Header.Get("Sec-WebSocket-Accept"); got != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("Sec-WebSocket-Accept = %q", got)
+	}
+
+	tests := []struct {
+		header []string
+		status int
+		check  string
+	}{
+		{nil, http.StatusUpgradeRequired, "Upgrade"},
+		{[]string{"Upgrade", "websocket", "Connection", "Upgrade", "Sec-WebSocket-Version", "8", "Sec-WebSocket-Key", "x"},
+			http.StatusUpgradeRequired, "Sec-WebSocket-Version"},
+		{[]string{"Upgrade", "websocket", "Connection", "Upgrade", "Sec-WebSocket-Version", "13"},
+			http.StatusBadRequest, ""},
+	}
+	for _, test := range tests {
+		req, _ := http.NewRequest("GET", srv.URL+"/echo", nil)
+		for i := 0; i+1 < len(test.header); i += 2 {
+			req.Header.Set(test.header[i], test.header[i+1])
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != test.status || test.check != "" && resp.Header.Get(test.check) == "" {
+			t.Errorf("handshake with %v = %v %v, want %v", test.header, resp.StatusCode, resp.Header, test.status)
+		}
+	}
+}
+
+func TestWebSocketMessages(t *testing.T) {
+	srv := newWebSocketServer(t)
+	defer srv.Close()
+	c, _ := dialWebSocket(t, srv, "dGhlIHNhbXBsZSBub25jZQ==")
+	defer c.conn.Close()
+
+	c.write(true, TextMessage, []byte("hello"), true)
+	if opcode, msg := c.read(); opcode != TextMessage || string(msg) != "hello" {
+		t.Errorf("echo = %v %q", opcode, msg)
+	}
+
+	// a ping between the fragments of a message is answered at once
+	c.write(false, BinaryMessage, []byte("frag"), true)
+	c.write(true, PingMessage, []byte("are you there"), true)
+	c.write(false, 0, []byte("men"), true)
+	c.write(true, 0, []byte("ted"), true)
+	if opcode, msg := c.read(); opcode != PongMessage || string(msg) != "are you there" {
+		t.Errorf("pong = %v %q", opcode, msg)
+	}
+	if opcode, msg := c.read(); opcode != BinaryMessage || string(msg) != "fragmented" {
+		t.Errorf("reassembled message = %v %q", opcode, msg)
+	}
+
+	c.write(true, TextMessage, []byte("ping me"), true)
+	if opcode, msg := c.read(); opcode != PingMessage || string(msg) != "p" {
+		t.Errorf("ping = %v %q", opcode, msg)
+	}
+	c.write(true, PongMessage, []byte("p"), true)
+	if _, msg := c.read(); string(msg) != "pong:p" {
+		t.Errorf("PongHandler got %q", msg)
+	}
+
+	payload := make([]byte, 2, 6)
+	binary.BigEndian.PutUint16(payload, CloseGoingAway)
+	c.write(true, CloseMessage, append(payload, "bye"...), true)
+	if code := c.expectClose(); code != CloseGoingAway {
+		t.Errorf("close code = %v, want the client's", code)
+	}
+}
+
+func TestWebSocketProtocolErrors(t *testing.T) {
+	srv := newWebSocketServer(t)
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		send func(c *wsClient)
+		code int
+	}{
+		{"unmasked frame", func(c *wsClient) { c.write(true, TextMessage, []byte("x"), false) }, CloseProtocolError},
+		{"oversized frame", func(c *wsClient) { c.write(true, BinaryMessage, make([]byte, 100), true) }, CloseMessageTooBig},
+		{"oversized message", func(c *wsClient) {
+			for i := 0; i < 3; i++ {
+				c.write(false, Ternary(i == 0, BinaryMessage, 0).(int), make([]byte, 60), true)
+			}
+		}, CloseMessageTooBig},
+		{"lone continuation", func(c *wsClient) { c.write(true, 0, []byte("x"), true) }, CloseProtocolError},
+		{"invalid utf-8", func(c *wsClient) { c.write(true, TextMessage, []byte{0xff}, true) }, CloseInvalidFramePayloadData},
+	}
+	for _, test := range tests {
+		c, _ := dialWebSocket(t, srv, "dGhlIHNhbXBsZSBub25jZQ==")
+		test.send(c)
+		if code := c.expectClose(); code != test.code {
+			t.Errorf("%v closed with %v, want %v", test.name, code, test.code)
+		}
+		c.conn.Close()
+	}
+}